@@ -3,6 +3,7 @@ module github.com/ideagate/core
 go 1.23.0
 
 require (
+	github.com/expr-lang/expr v1.17.8
 	github.com/ideagate/model/gen-go v0.0.0-20250405233858-080667362b54
 	github.com/onsi/ginkgo/v2 v2.22.1
 	github.com/onsi/gomega v1.36.2
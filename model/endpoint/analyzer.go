@@ -0,0 +1,200 @@
+package endpoint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+)
+
+// Issue is a broken reference found by the analyzer.
+type Issue struct {
+	StepId   string `json:"step_id"`
+	Location string `json:"location"` // where the variable is declared in the step, ex: variables.user_id
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+// AnalysisError holds every issue found in a workflow.
+type AnalysisError struct {
+	Issues []Issue `json:"issues"`
+}
+
+func (e *AnalysisError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		messages = append(messages, fmt.Sprintf("step %q %s: %s", issue.StepId, issue.Location, issue.Message))
+	}
+
+	return "invalid workflow: " + strings.Join(messages, "; ")
+}
+
+// References returns every context path referenced by the variable value, ex: Req.Query.x,
+// Step.<StepId>.Data.Body or Var.y. The options enabling syntaxes are the ones given to GetValue.
+func (v *Variable) References(opts ...Option) ([]string, error) {
+	return variableReferences(v.Value, newOptions(opts).syntax)
+}
+
+// AnalyzeWorkflow checks every variable of every step and returns an *AnalysisError when a variable can't be
+// parsed or references a step that doesn't exist or doesn't run before it. The options enabling syntaxes are
+// the ones given to GetValue.
+func AnalyzeWorkflow(workflow *pbEndpoint.Workflow, opts ...Option) error {
+	if workflow == nil {
+		return nil
+	}
+
+	var (
+		steps     = make(map[string]*pbEndpoint.Step, len(workflow.Steps))
+		upstreams = workflowUpstreams(workflow)
+		issues    []Issue
+	)
+	for _, step := range workflow.Steps {
+		if step != nil {
+			steps[step.Id] = step
+		}
+	}
+
+	for _, step := range workflow.Steps {
+		if step == nil {
+			continue
+		}
+
+		for _, located := range stepVariables(step) {
+			issues = append(issues, analyzeVariable(step.Id, located.location, located.variable, steps, upstreams[step.Id], opts)...)
+		}
+	}
+
+	if len(issues) > 0 {
+		return &AnalysisError{Issues: issues}
+	}
+
+	return nil
+}
+
+func analyzeVariable(stepId, location string, variable *Variable, steps map[string]*pbEndpoint.Step, upstreams map[string]bool, opts []Option) []Issue {
+	references, err := variable.References(opts...)
+	if err != nil {
+		return []Issue{{StepId: stepId, Location: location, Message: err.Error()}}
+	}
+
+	var issues []Issue
+	for _, reference := range references {
+		parts := strings.Split(reference, ".")
+		if parts[0] != "Step" || len(parts) < 2 {
+			continue
+		}
+
+		referencedStepId := parts[1]
+		switch {
+		case referencedStepId == stepId:
+			// a step can read its own data
+		case steps[referencedStepId] == nil:
+			issues = append(issues, Issue{StepId: stepId, Location: location, Path: reference,
+				Message: fmt.Sprintf("step %q doesn't exist", referencedStepId)})
+		case !upstreams[referencedStepId]:
+			issues = append(issues, Issue{StepId: stepId, Location: location, Path: reference,
+				Message: fmt.Sprintf("step %q is not upstream of step %q", referencedStepId, stepId)})
+		}
+	}
+
+	return issues
+}
+
+// workflowUpstreams returns, for every step, the set of steps that can run before it following the edges and the
+// next steps of the returns.
+func workflowUpstreams(workflow *pbEndpoint.Workflow) map[string]map[string]bool {
+	parents := make(map[string][]string)
+	for _, edge := range workflow.Edges {
+		if edge != nil {
+			parents[edge.Dest] = append(parents[edge.Dest], edge.Source)
+		}
+	}
+	for _, step := range workflow.Steps {
+		for _, stepReturn := range step.GetReturns() {
+			if next := stepReturn.GetNextStepId(); next != "" {
+				parents[next] = append(parents[next], step.GetId())
+			}
+		}
+	}
+
+	result := make(map[string]map[string]bool, len(workflow.Steps))
+	for _, step := range workflow.Steps {
+		if step == nil {
+			continue
+		}
+
+		visited := make(map[string]bool)
+		queue := append([]string{}, parents[step.Id]...)
+
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			if visited[current] {
+				continue
+			}
+			visited[current] = true
+			queue = append(queue, parents[current]...)
+		}
+
+		result[step.Id] = visited
+	}
+
+	return result
+}
+
+type locatedVariable struct {
+	location string
+	variable *Variable
+}
+
+// stepVariables returns every variable declared in a step with a stable order.
+func stepVariables(step *pbEndpoint.Step) []locatedVariable {
+	var result []locatedVariable
+
+	add := func(location string, variable *pbEndpoint.Variable) {
+		if variable != nil {
+			result = append(result, locatedVariable{location: location, variable: (*Variable)(variable)})
+		}
+	}
+	addMap := func(prefix string, variables map[string]*pbEndpoint.Variable) {
+		names := make([]string, 0, len(variables))
+		for name := range variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			add(prefix+"."+name, variables[name])
+		}
+	}
+	// templates kept as plain strings in the step
+	addValue := func(location, value string) {
+		if value != "" {
+			result = append(result, locatedVariable{location: location, variable: &Variable{Value: value}})
+		}
+	}
+
+	addMap("variables", step.GetVariables())
+	addMap("outputs", step.GetOutputs())
+
+	if rest := step.GetAction().GetRest(); rest != nil {
+		add("action.rest.path", rest.GetPath())
+		addMap("action.rest.headers", rest.GetHeaders())
+		addValue("action.rest.request_body", rest.GetRequestBody())
+	}
+
+	for i, query := range step.GetAction().GetMysql().GetQueries() {
+		add(fmt.Sprintf("action.mysql.queries[%d].query", i), query.GetQuery())
+		for j, parameter := range query.GetParameters() {
+			add(fmt.Sprintf("action.mysql.queries[%d].parameters[%d]", i, j), parameter)
+		}
+	}
+
+	for i, stepReturn := range step.GetReturns() {
+		addValue(fmt.Sprintf("returns[%d].is_finish_condition", i), stepReturn.GetIsFinishCondition())
+	}
+
+	return result
+}
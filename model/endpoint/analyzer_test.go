@@ -0,0 +1,110 @@
+package endpoint
+
+import (
+	"errors"
+
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Analyzer", func() {
+	// start -> auth -> mysql -> end
+	//       \-> rest ----------/
+	newWorkflow := func() *pbEndpoint.Workflow {
+		return &pbEndpoint.Workflow{
+			Steps: []*pbEndpoint.Step{
+				{Id: "start"},
+				{Id: "auth", Variables: map[string]*pbEndpoint.Variable{
+					"token": {Value: "{{.Req.Header.Authorization}}"},
+				}},
+				{Id: "rest", Action: &pbEndpoint.Action{Rest: &pbEndpoint.ActionRest{
+					Path: &pbEndpoint.Variable{Value: "/users/{{.Req.Query.id}}"},
+				}}},
+				{Id: "mysql", Action: &pbEndpoint.Action{Mysql: &pbEndpoint.ActionMysql{
+					Queries: []*pbEndpoint.Query{{
+						Query: &pbEndpoint.Variable{Value: "SELECT * FROM user WHERE id = ?"},
+						Parameters: []*pbEndpoint.Variable{
+							{Value: "$.Step.auth.Out.user_id"},
+						},
+					}},
+				}}},
+				{Id: "end", Outputs: map[string]*pbEndpoint.Variable{
+					"user": {Value: "{{(index .Step.mysql.Data.Query.q 0).name}}"},
+					"rest": {Value: "{{.Step.rest.Data.Body}}"},
+				}},
+			},
+			Edges: []*pbEndpoint.Edge{
+				{Source: "start", Dest: "auth"},
+				{Source: "auth", Dest: "mysql"},
+				{Source: "mysql", Dest: "end"},
+				{Source: "start", Dest: "rest"},
+				{Source: "rest", Dest: "end"},
+			},
+		}
+	}
+
+	It("References", func() {
+		variable := &Variable{Value: "{{.Step.auth.Out.user_id}}-{{.Req.Query.x}}-{{.Var.y}}"}
+		references, err := variable.References()
+		Expect(err).To(BeNil())
+		Expect(references).To(Equal([]string{"Req.Query.x", "Step.auth.Out.user_id", "Var.y"}))
+	})
+
+	It("valid workflow", func() {
+		Expect(AnalyzeWorkflow(newWorkflow())).To(Succeed())
+	})
+
+	It("follows the next steps of the returns and skips nil steps", func() {
+		workflow := newWorkflow()
+		workflow.Steps = append(workflow.Steps, nil, &pbEndpoint.Step{Id: "retry", Variables: map[string]*pbEndpoint.Variable{
+			"user":  {Value: "{{.Step.mysql.Data.Body}}"},
+			"unset": nil,
+		}})
+		workflow.Steps[3].Returns = []*pbEndpoint.Return{{Id: "retry", NextStepId: "retry"}}
+		workflow.Edges = append(workflow.Edges, nil)
+
+		Expect(AnalyzeWorkflow(workflow)).To(Succeed())
+	})
+
+	It("reports unknown, not upstream and invalid references", func() {
+		workflow := newWorkflow()
+		workflow.Steps[2].Action.Rest.Headers = map[string]*pbEndpoint.Variable{
+			"X-User": {Value: "{{.Step.auth.Out.user_id}}"},
+		}
+		workflow.Steps[3].Variables = map[string]*pbEndpoint.Variable{
+			"missing": {Value: "$.Step.unknown.Data.Body"},
+			"self":    {Value: "{{.Step.mysql.Data.StatusCode}}"},
+			"broken":  {Value: "{{.Req.Query.x"},
+		}
+		workflow.Steps[3].Returns = []*pbEndpoint.Return{
+			{Id: "done", IsFinishCondition: `{{eq (index .Step "rest").Data.StatusCode 200}}`},
+		}
+		workflow.Steps[2].Action.Rest.RequestBody = `{"user": {{index .Step "user-lookup" "Out" | toJson}}}`
+
+		err := AnalyzeWorkflow(workflow, WithSyntax(SyntaxPath))
+
+		var analysisErr *AnalysisError
+		Expect(errors.As(err, &analysisErr)).To(BeTrue())
+		Expect(analysisErr.Issues).To(HaveLen(5))
+
+		Expect(analysisErr.Issues[0].StepId).To(Equal("rest"))
+		Expect(analysisErr.Issues[0].Location).To(Equal("action.rest.headers.X-User"))
+		Expect(analysisErr.Issues[0].Path).To(Equal("Step.auth.Out.user_id"))
+		Expect(analysisErr.Issues[0].Message).To(ContainSubstring("not upstream"))
+
+		Expect(analysisErr.Issues[1].Location).To(Equal("action.rest.request_body"))
+		Expect(analysisErr.Issues[1].Path).To(Equal("Step.user-lookup.Out"))
+		Expect(analysisErr.Issues[1].Message).To(ContainSubstring("doesn't exist"))
+
+		Expect(analysisErr.Issues[2].StepId).To(Equal("mysql"))
+		Expect(analysisErr.Issues[2].Location).To(Equal("variables.broken"))
+
+		Expect(analysisErr.Issues[3].Location).To(Equal("variables.missing"))
+		Expect(analysisErr.Issues[3].Message).To(ContainSubstring("doesn't exist"))
+
+		Expect(analysisErr.Issues[4].Location).To(Equal("returns[0].is_finish_condition"))
+		Expect(analysisErr.Issues[4].Path).To(Equal("Step.rest.Data.StatusCode"))
+		Expect(analysisErr.Issues[4].Message).To(ContainSubstring("not upstream"))
+	})
+})
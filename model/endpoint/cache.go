@@ -0,0 +1,90 @@
+package endpoint
+
+import (
+	"container/list"
+	"sync"
+)
+
+const compiledCacheSize = 1024
+
+var (
+	templateCache = newLRUCache[*compiledTemplate](compiledCacheSize)
+	pathCache     = newLRUCache[*pathExpression](compiledCacheSize)
+)
+
+// lruCache is a bounded, concurrency-safe cache keyed by expression text. The least recently used entry is
+// evicted when the cache is full.
+type lruCache[T any] struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // front is the most recently used
+}
+
+type lruCacheEntry[T any] struct {
+	key   string
+	value T
+}
+
+func newLRUCache[T any](capacity int) *lruCache[T] {
+	return &lruCache[T]{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (c *lruCache[T]) Get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		var empty T
+		return empty, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*lruCacheEntry[T]).value, true
+}
+
+func (c *lruCache[T]) Set(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		element.Value.(*lruCacheEntry[T]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruCacheEntry[T]{key: key, value: value})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruCacheEntry[T]).key)
+	}
+}
+
+func (c *lruCache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// getOrCompile returns the cached value of key or compiles and caches it. Compile errors are not cached.
+func (c *lruCache[T]) getOrCompile(key string, compile func(string) (T, error)) (T, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	value, err := compile(key)
+	if err != nil {
+		return value, err
+	}
+
+	c.Set(key, value)
+	return value, nil
+}
@@ -0,0 +1,184 @@
+package endpoint
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := newLRUCache[int](2)
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a") // "b" is now the least recently used
+	cache.Set("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Get(b) found, want evicted")
+	}
+	if got, ok := cache.Get("a"); !ok || got != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1, true", got, ok)
+	}
+	if got := cache.Len(); got != 2 {
+		t.Errorf("Len() = %v, want 2", got)
+	}
+
+	compiled := 0
+	compile := func(key string) (int, error) {
+		compiled++
+		if key == "invalid" {
+			return 0, fmt.Errorf("invalid")
+		}
+		return len(key), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if got, err := cache.getOrCompile("dddd", compile); err != nil || got != 4 {
+			t.Errorf("getOrCompile(dddd) = %v, %v, want 4, nil", got, err)
+		}
+	}
+	if compiled != 1 {
+		t.Errorf("compiled %d times, want 1", compiled)
+	}
+
+	if _, err := cache.getOrCompile("invalid", compile); err == nil {
+		t.Errorf("getOrCompile(invalid) error = nil, want error")
+	}
+	if _, ok := cache.Get("invalid"); ok {
+		t.Errorf("Get(invalid) found, compile errors must not be cached")
+	}
+}
+
+func TestLRUCache_concurrent(t *testing.T) {
+	cache := newLRUCache[int](16)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("key_%d", (worker*j)%32)
+				_, _ = cache.getOrCompile(key, func(string) (int, error) { return j, nil })
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := cache.Len(); got > 16 {
+		t.Errorf("Len() = %v, want <= 16", got)
+	}
+}
+
+// newBenchmarkCtxData returns the context data of an execution midway through a workflow: a request with a json
+// body and steps holding the rows of their queries.
+func newBenchmarkCtxData() *entityContext.ContextData {
+	ctxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Query: map[string]any{"query_1": "value_query_1"},
+			Json:  make(map[string]any, 100),
+		},
+		Step: make(map[string]entityContext.ContextStepData, 20),
+	}
+
+	for i := 0; i < 100; i++ {
+		ctxData.Req.Json[fmt.Sprintf("field_%d", i)] = fmt.Sprintf("value_%d", i)
+	}
+
+	for step := 0; step < 20; step++ {
+		rows := make([]any, 200)
+		for row := range rows {
+			rows[row] = map[string]any{"col_a": fmt.Sprintf("val_a_%d", row), "col_b": row, "col_c": true, "col_d": 1.5, "col_e": "text"}
+		}
+		ctxData.Step[fmt.Sprintf("step_%d", step)] = entityContext.ContextStepData{
+			Data: entityContext.ContextStepDataBody{Query: map[string]any{"query_1": rows}},
+		}
+	}
+
+	return ctxData
+}
+
+func BenchmarkVariable_GetValue(b *testing.B) {
+	ctxData := newBenchmarkCtxData()
+
+	b.Run("template uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			// a new template text every time misses the cache
+			variable := &Variable{
+				Value: fmt.Sprintf("{{(index .Step.step_0.Data.Query.query_1 0).col_a}}-{{.Req.Query.query_1}}{{/* %d */}}", i),
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			}
+			_, _ = variable.GetValue("step_0", ctxData)
+		}
+	})
+
+	b.Run("template cached", func(b *testing.B) {
+		variable := &Variable{
+			Value: "{{(index .Step.step_0.Data.Query.query_1 0).col_a}}-{{.Req.Query.query_1}}",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = variable.GetValue("step_0", ctxData)
+		}
+	})
+
+	b.Run("path cached", func(b *testing.B) {
+		variable := &Variable{
+			Value: "$.Step.step_0.Data.Query.query_1[0].col_a",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = variable.GetValue("step_0", ctxData, WithSyntax(SyntaxPath))
+		}
+	})
+
+	b.Run("expression cached", func(b *testing.B) {
+		variable := &Variable{
+			Value: "expr:Step.step_0.Data.Query.query_1[0].col_b >= 0",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_BOOL,
+		}
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = variable.GetValue("step_0", ctxData, WithSyntax(SyntaxExpression))
+		}
+	})
+
+	b.Run("literal", func(b *testing.B) {
+		variable := &Variable{
+			Value: "plain value",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = variable.GetValue("step_0", ctxData)
+		}
+	})
+}
+
+func BenchmarkResolveVariables(b *testing.B) {
+	ctxData := newBenchmarkCtxData()
+
+	variables := make(map[string]*Variable, 10)
+	for i := 0; i < 10; i++ {
+		variables[fmt.Sprintf("var_%d", i)] = &Variable{
+			Value: fmt.Sprintf("{{.Req.Json.field_%d}}", i),
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = ResolveVariables("step_0", ctxData, variables)
+	}
+}
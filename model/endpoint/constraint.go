@@ -0,0 +1,258 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	"github.com/spf13/cast"
+)
+
+// Format is a well known string format checked by Constraint.Format.
+type Format string
+
+const (
+	FormatEmail Format = "email"
+	FormatUUID  Format = "uuid"
+	FormatURL   Format = "url"
+)
+
+// Constraint rules, used as Violation.Rule.
+const (
+	RuleRequired  = "required"
+	RuleMin       = "min"
+	RuleMax       = "max"
+	RuleMinLength = "minLength"
+	RuleMaxLength = "maxLength"
+	RulePattern   = "pattern"
+	RuleEnum      = "enum"
+	RuleFormat    = "format"
+	RuleType      = "type"
+)
+
+// Constraint declares the rules a resolved variable value must satisfy. Rules other than Required are
+// skipped when the value is empty.
+type Constraint struct {
+	Required  bool     // value must not be empty after the default is applied
+	Min       *float64 // numbers only
+	Max       *float64 // numbers only
+	MinLength *int     // characters of a string, elements of an array or map
+	MaxLength *int     // characters of a string, elements of an array or map
+	Pattern   string   // regular expression a string must match
+	Enum      []any    // allowed values
+	Format    Format
+}
+
+// Violation is a single failed rule of a variable.
+type Violation struct {
+	Name    string `json:"name"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError holds every violation found, it can be returned as a 400 response body.
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		if violation.Name == "" {
+			messages = append(messages, violation.Message)
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s", violation.Name, violation.Message))
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+var (
+	uuidRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	patternCache = newLRUCache[*regexp.Regexp](compiledCacheSize)
+)
+
+// ValidateVariables resolves every variable with its constraint and returns the values by name. All
+// violations are aggregated into a single *ValidationError. Nil variables are skipped.
+func ValidateVariables(stepId string, ctxData *entityContext.ContextData, variables map[string]*Variable, constraints map[string]Constraint, opts ...Option) (map[string]any, error) {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		values        = make(map[string]any, len(variables))
+		validationErr = &ValidationError{}
+		view          = ctxData.View()
+	)
+
+	for _, name := range names {
+		variable := variables[name]
+		if variable == nil {
+			continue
+		}
+
+		variableOpts := append(append([]Option{}, opts...), WithName(name), withView())
+		if constraint, ok := constraints[name]; ok {
+			variableOpts = append(variableOpts, WithConstraint(constraint))
+		}
+
+		value, err := variable.GetValue(stepId, view, variableOpts...)
+		if err == nil {
+			values[name] = value
+			continue
+		}
+
+		var (
+			constraintErr *ValidationError
+			variableErr   *VariableError
+		)
+		switch {
+		case errors.As(err, &constraintErr):
+			validationErr.Violations = append(validationErr.Violations, constraintErr.Violations...)
+		case errors.As(err, &variableErr):
+			rule := RuleType
+			if errors.Is(err, ErrRequiredValue) {
+				rule = RuleRequired
+			}
+			validationErr.Violations = append(validationErr.Violations, Violation{Name: name, Rule: rule, Message: variableErr.Err.Error()})
+		default:
+			return nil, err
+		}
+	}
+
+	if len(validationErr.Violations) > 0 {
+		return values, validationErr
+	}
+
+	return values, nil
+}
+
+// validate checks value against every rule and returns the violations found.
+func (c *Constraint) validate(name string, value any, isEmpty bool) ([]Violation, error) {
+	var violations []Violation
+	addViolation := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Name: name, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if isEmpty {
+		if c.Required {
+			addViolation(RuleRequired, "is required")
+		}
+		return violations, nil
+	}
+
+	if c.Min != nil || c.Max != nil {
+		number, ok := constraintNumber(value)
+		switch {
+		case !ok:
+			addViolation(RuleType, "must be a number to check min and max")
+		case c.Min != nil && number.Cmp(new(big.Rat).SetFloat64(*c.Min)) < 0:
+			addViolation(RuleMin, "must be greater than or equal to %v", *c.Min)
+		case c.Max != nil && number.Cmp(new(big.Rat).SetFloat64(*c.Max)) > 0:
+			addViolation(RuleMax, "must be less than or equal to %v", *c.Max)
+		}
+	}
+
+	if c.MinLength != nil || c.MaxLength != nil {
+		length, ok := constraintLength(value)
+		switch {
+		case !ok:
+			addViolation(RuleType, "must be a string, array or object to check length")
+		case c.MinLength != nil && length < *c.MinLength:
+			addViolation(RuleMinLength, "length must be at least %d", *c.MinLength)
+		case c.MaxLength != nil && length > *c.MaxLength:
+			addViolation(RuleMaxLength, "length must be at most %d", *c.MaxLength)
+		}
+	}
+
+	if c.Pattern != "" {
+		pattern, err := patternCache.getOrCompile(c.Pattern, regexp.Compile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", c.Pattern, err)
+		}
+		if !pattern.MatchString(cast.ToString(value)) {
+			addViolation(RulePattern, "must match pattern %s", c.Pattern)
+		}
+	}
+
+	if len(c.Enum) > 0 {
+		found := false
+		for _, allowed := range c.Enum {
+			if compareEqual(value, allowed) || cast.ToString(value) == cast.ToString(allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addViolation(RuleEnum, "must be one of %v", c.Enum)
+		}
+	}
+
+	if c.Format != "" && !isValidFormat(c.Format, cast.ToString(value)) {
+		addViolation(RuleFormat, "must be a valid %s", c.Format)
+	}
+
+	return violations, nil
+}
+
+func constraintNumber(value any) (*big.Rat, bool) {
+	switch typed := value.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(typed.String())
+	case float32, float64:
+		number := cast.ToFloat64(typed)
+		if number != number { // NaN
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(number), true
+	}
+
+	if isInteger(value) {
+		return new(big.Rat).SetString(cast.ToString(value))
+	}
+
+	return nil, false
+}
+
+func constraintLength(value any) (int, bool) {
+	if s, ok := value.(string); ok {
+		return utf8.RuneCountInString(s), true
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return reflectValue.Len(), true
+	}
+
+	return 0, false
+}
+
+func isValidFormat(format Format, value string) bool {
+	switch format {
+	case FormatEmail:
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+
+	case FormatUUID:
+		return uuidRegex.MatchString(value)
+
+	case FormatURL:
+		parsed, err := url.ParseRequestURI(value)
+		return err == nil && parsed.Scheme != "" && parsed.Host != ""
+	}
+
+	return false
+}
@@ -0,0 +1,184 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	"github.com/ideagate/core/utils"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Constraint", func() {
+	mockStepId := "mockStepId"
+
+	mockCtxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Query: map[string]any{
+				"age":    17,
+				"name":   "John",
+				"email":  "john@example.com",
+				"id":     "8c1f6f5e-8d5f-4a4b-9a7e-1f2b3c4d5e6f",
+				"url":    "https://example.com/path",
+				"status": "active",
+				"amount": "100000000000000000.01",
+			},
+			Json: map[string]any{
+				"tags": []any{"a", "b", "c"},
+			},
+		},
+		Step: map[string]entityContext.ContextStepData{
+			mockStepId: {},
+		},
+	}
+
+	runTest := func(variable *Variable, constraint Constraint, wantRules []string) {
+		got, err := variable.GetValue(mockStepId, mockCtxData, WithName("mockVar"), WithSyntax(SyntaxPath), WithConstraint(constraint))
+
+		if len(wantRules) == 0 {
+			Expect(err).To(BeNil())
+			return
+		}
+
+		Expect(got).To(BeNil())
+
+		var validationErr *ValidationError
+		Expect(errors.As(err, &validationErr)).To(BeTrue())
+
+		rules := make([]string, 0, len(validationErr.Violations))
+		for _, violation := range validationErr.Violations {
+			Expect(violation.Name).To(Equal("mockVar"))
+			rules = append(rules, violation.Rule)
+		}
+		Expect(rules).To(Equal(wantRules))
+	}
+
+	intVariable := &Variable{Value: "{{.Req.Query.age}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT}
+	stringVariable := &Variable{Value: "{{.Req.Query.name}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}
+	missingVariable := &Variable{Value: "{{.Req.Query.unknown}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}
+
+	DescribeTable("Rules", runTest,
+		Entry("required - present", stringVariable, Constraint{Required: true}, nil),
+		Entry("required - missing", missingVariable, Constraint{Required: true}, []string{RuleRequired}),
+		Entry("required - default applied", &Variable{
+			Value:    "{{.Req.Query.unknown}}",
+			Type:     pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			Required: true,
+			Default:  "default_value",
+		}, Constraint{Required: true}, nil),
+		Entry("min - valid", intVariable, Constraint{Min: utils.ToPtr(17.0)}, nil),
+		Entry("min - invalid", intVariable, Constraint{Min: utils.ToPtr(18.0)}, []string{RuleMin}),
+		Entry("max - invalid", intVariable, Constraint{Max: utils.ToPtr(16.0)}, []string{RuleMax}),
+		Entry("max - decimal keeps precision", &Variable{
+			Value: "{{.Req.Query.amount}}",
+			Type:  VariableTypeDecimal,
+		}, Constraint{Max: utils.ToPtr(100000000000000000.0)}, []string{RuleMax}),
+		Entry("min - not a number", stringVariable, Constraint{Min: utils.ToPtr(1.0)}, []string{RuleType}),
+		Entry("minLength - invalid", stringVariable, Constraint{MinLength: utils.ToPtr(5)}, []string{RuleMinLength}),
+		Entry("maxLength - array", &Variable{
+			Value: "$.Req.Json.tags",
+			Type:  VariableTypeArray,
+		}, Constraint{MaxLength: utils.ToPtr(2)}, []string{RuleMaxLength}),
+		Entry("pattern - valid", stringVariable, Constraint{Pattern: "^[A-Z][a-z]+$"}, nil),
+		Entry("pattern - invalid", stringVariable, Constraint{Pattern: "^[a-z]+$"}, []string{RulePattern}),
+		Entry("enum - valid", &Variable{
+			Value: "{{.Req.Query.status}}",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}, Constraint{Enum: []any{"active", "inactive"}}, nil),
+		Entry("enum - number", intVariable, Constraint{Enum: []any{17, 18}}, nil),
+		Entry("enum - invalid", stringVariable, Constraint{Enum: []any{"active", "inactive"}}, []string{RuleEnum}),
+		Entry("format email - valid", &Variable{
+			Value: "{{.Req.Query.email}}",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}, Constraint{Format: FormatEmail}, nil),
+		Entry("format email - invalid", stringVariable, Constraint{Format: FormatEmail}, []string{RuleFormat}),
+		Entry("format uuid - valid", &Variable{
+			Value: "{{.Req.Query.id}}",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}, Constraint{Format: FormatUUID}, nil),
+		Entry("format url - valid", &Variable{
+			Value: "{{.Req.Query.url}}",
+			Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+		}, Constraint{Format: FormatURL}, nil),
+		Entry("format url - invalid", stringVariable, Constraint{Format: FormatURL}, []string{RuleFormat}),
+		Entry("multiple violations", stringVariable, Constraint{
+			MinLength: utils.ToPtr(5),
+			Pattern:   "^[0-9]+$",
+			Format:    FormatUUID,
+		}, []string{RuleMinLength, RulePattern, RuleFormat}),
+		Entry("empty value skips rules", missingVariable, Constraint{MinLength: utils.ToPtr(5), Format: FormatEmail}, nil),
+	)
+
+	It("invalid pattern", func() {
+		_, err := stringVariable.GetValue(mockStepId, mockCtxData, WithConstraint(Constraint{Pattern: "["}))
+		Expect(err).To(HaveOccurred())
+
+		var validationErr *ValidationError
+		Expect(errors.As(err, &validationErr)).To(BeFalse())
+	})
+
+	Describe("ValidateVariables", func() {
+		It("aggregates every violation", func() {
+			variables := map[string]*Variable{
+				"age":   intVariable,
+				"name":  stringVariable,
+				"email": missingVariable,
+				"count": {Value: "abc", Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT},
+			}
+			constraints := map[string]Constraint{
+				"age":   {Min: utils.ToPtr(18.0)},
+				"name":  {MaxLength: utils.ToPtr(10)},
+				"email": {Required: true, Format: FormatEmail},
+			}
+
+			values, err := ValidateVariables(mockStepId, mockCtxData, variables, constraints)
+			Expect(values).To(Equal(map[string]any{"name": "John"}))
+
+			var validationErr *ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Violations).To(HaveLen(3))
+			Expect(validationErr.Violations[0].Name).To(Equal("age"))
+			Expect(validationErr.Violations[0].Rule).To(Equal(RuleMin))
+			Expect(validationErr.Violations[1].Name).To(Equal("count"))
+			Expect(validationErr.Violations[1].Rule).To(Equal(RuleType))
+			Expect(validationErr.Violations[2].Name).To(Equal("email"))
+			Expect(validationErr.Violations[2].Rule).To(Equal(RuleRequired))
+
+			body, err := json.Marshal(validationErr)
+			Expect(err).To(BeNil())
+			Expect(string(body)).To(ContainSubstring(`"rule":"min"`))
+		})
+		It("reports a required value as the required rule", func() {
+			_, err := ValidateVariables(mockStepId, mockCtxData, map[string]*Variable{
+				"token": {Value: "{{.Req.Query.unknown}}", Required: true},
+			}, nil, WithValuePolicy(ValuePolicy{Required: ValueMissing}))
+
+			var validationErr *ValidationError
+			Expect(errors.As(err, &validationErr)).To(BeTrue())
+			Expect(validationErr.Violations).To(HaveLen(1))
+			Expect(validationErr.Violations[0].Rule).To(Equal(RuleRequired))
+			Expect(validationErr.Violations[0].Message).To(ContainSubstring("required value"))
+		})
+		It("skips a nil variable", func() {
+			values, err := ValidateVariables(mockStepId, mockCtxData, map[string]*Variable{
+				"age":     intVariable,
+				"missing": nil,
+			}, map[string]Constraint{
+				"missing": {Required: true},
+			})
+			Expect(err).To(BeNil())
+			Expect(values).To(Equal(map[string]any{"age": int64(17)}))
+		})
+		It("returns every value when valid", func() {
+			values, err := ValidateVariables(mockStepId, mockCtxData, map[string]*Variable{
+				"age": intVariable,
+			}, map[string]Constraint{
+				"age": {Required: true, Min: utils.ToPtr(1.0)},
+			})
+			Expect(err).To(BeNil())
+			Expect(values).To(Equal(map[string]any{"age": int64(17)}))
+		})
+	})
+})
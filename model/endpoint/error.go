@@ -0,0 +1,82 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	// ErrMissingValue is returned in strict mode when a referenced key doesn't exist in the context data.
+	ErrMissingValue = errors.New("missing value")
+)
+
+// VariableError describes a failure to resolve a variable.
+type VariableError struct {
+	StepId   string
+	Name     string // variable name, set with WithName
+	Template string // variable value, a template or path expression
+	Path     string // failing path inside the template, ex: .Req.Query.unknown
+	Err      error
+}
+
+func (e *VariableError) Error() string {
+	var builder strings.Builder
+
+	builder.WriteString("step ")
+	builder.WriteString(fmt.Sprintf("%q", e.StepId))
+	if e.Name != "" {
+		builder.WriteString(fmt.Sprintf(" variable %q", e.Name))
+	}
+	builder.WriteString(fmt.Sprintf(" value %q", e.Template))
+	if e.Path != "" {
+		builder.WriteString(fmt.Sprintf(" at %s", e.Path))
+	}
+	builder.WriteString(": ")
+	builder.WriteString(e.Err.Error())
+
+	return builder.String()
+}
+
+func (e *VariableError) Unwrap() error {
+	return e.Err
+}
+
+func (v *Variable) newError(stepId string, opt *options, path string, err error) error {
+	var variableErr *VariableError
+	if errors.As(err, &variableErr) {
+		return err
+	}
+
+	return &VariableError{
+		StepId:   stepId,
+		Name:     opt.name,
+		Template: v.Value,
+		Path:     path,
+		Err:      err,
+	}
+}
+
+var execErrorPathRegex = regexp.MustCompile(`at <([^>]*)>: (.*)$`)
+
+// parseExecError extracts the failing path from a template execution error and marks missing keys with
+// ErrMissingValue.
+func parseExecError(err error) (path string, cause error) {
+	var execErr template.ExecError
+	if !errors.As(err, &execErr) {
+		return "", err
+	}
+
+	message := execErr.Err.Error()
+	if match := execErrorPathRegex.FindStringSubmatch(message); match != nil {
+		path, message = match[1], match[2]
+	}
+
+	if strings.Contains(message, "map has no entry for key") || strings.Contains(message, "nil pointer evaluating") {
+		return path, fmt.Errorf("%w: %s", ErrMissingValue, message)
+	}
+
+	return path, errors.New(message)
+}
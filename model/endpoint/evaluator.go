@@ -0,0 +1,115 @@
+package endpoint
+
+import (
+	"strings"
+	"sync"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	"github.com/spf13/cast"
+)
+
+// IEvaluator evaluates an expression against the root object seen by templates (Req, Step, Var and Data)
+// and returns a typed result, ex: bool, int64, float64, string, list or map.
+type IEvaluator interface {
+	Evaluate(expression string, env any) (any, error)
+}
+
+// IReferenceEvaluator is implemented by evaluators able to list the context paths used by an expression,
+// the analyzer and the dependency resolver see those references.
+type IReferenceEvaluator interface {
+	IEvaluator
+	References(expression string) ([]string, error)
+}
+
+// EvaluatorExpr is the name of the built-in evaluator, a variable value "expr:Req.Query.age >= 18"
+// is evaluated by it.
+const EvaluatorExpr = "expr"
+
+var (
+	evaluatorsMutex sync.RWMutex
+	evaluators      = map[string]IEvaluator{
+		EvaluatorExpr: NewExprEvaluator(),
+	}
+)
+
+// RegisterEvaluator makes an evaluator available to variables whose value starts with "<name>:",
+// ex: RegisterEvaluator("cel", celEvaluator) for "cel:request.age >= 18", read with WithSyntax(SyntaxExpression).
+// A nil evaluator removes it.
+func RegisterEvaluator(name string, evaluator IEvaluator) {
+	evaluatorsMutex.Lock()
+	defer evaluatorsMutex.Unlock()
+
+	if evaluator == nil {
+		delete(evaluators, name)
+		return
+	}
+	evaluators[name] = evaluator
+}
+
+// lookupEvaluator returns the evaluator and the expression of a value prefixed by an evaluator name, when
+// SyntaxExpression is enabled.
+func lookupEvaluator(value string, syntax Syntax) (IEvaluator, string, bool) {
+	if syntax&SyntaxExpression == 0 {
+		return nil, "", false
+	}
+
+	name, expression, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		return nil, "", false
+	}
+
+	evaluatorsMutex.RLock()
+	defer evaluatorsMutex.RUnlock()
+
+	evaluator, ok := evaluators[name]
+	return evaluator, strings.TrimSpace(expression), ok
+}
+
+// getValueFromExpression evaluates the expression, a nil result is null as evaluators don't tell a missing
+// member from a null one.
+func (v *Variable) getValueFromExpression(stepId string, ctxData *entityContext.ContextData, evaluator IEvaluator, expression string, opt *options) (interface{}, ValueState, error) {
+	data := newVariableData(stepId, ctxData, opt)
+	cancel, err := data.state.start()
+	defer cancel()
+	if err != nil {
+		return nil, ValueMissing, v.newError(stepId, opt, "", err)
+	}
+
+	result, err := evaluator.Evaluate(expression, data)
+	if err != nil {
+		return nil, ValueMissing, v.newError(stepId, opt, "", err)
+	}
+
+	// an evaluator can't be interrupted, the limits are checked once it's done
+	if err = data.state.checkContext(); err == nil {
+		err = data.state.checkOutputSize(result)
+	}
+	if err != nil {
+		return nil, ValueMissing, v.newError(stepId, opt, "", err)
+	}
+
+	return result, valueState(result, ValueNull), nil
+}
+
+// EvaluateCondition resolves the condition of a condition step as a boolean. The condition can be an
+// expression, ex: "expr:Step.auth.Data.StatusCode == 200", a path, each with its syntax enabled by the options,
+// or a template rendering "true" or "false". An empty condition is false.
+func EvaluateCondition(stepId string, ctxData *entityContext.ContextData, condition string, opts ...Option) (bool, error) {
+	variable := &Variable{Value: condition}
+
+	value, err := variable.GetValue(stepId, ctxData, opts...)
+	if err != nil || value == nil {
+		return false, err
+	}
+
+	if boolValue, ok := value.(bool); ok {
+		return boolValue, nil
+	}
+
+	result, err := cast.ToBoolE(value)
+	if err != nil {
+		return false, variable.newError(stepId, newOptions(opts), "", castError(value, "bool"))
+	}
+
+	return result, nil
+}
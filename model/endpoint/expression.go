@@ -0,0 +1,266 @@
+package endpoint
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
+	"github.com/spf13/cast"
+)
+
+// exprEvaluator evaluates expr-lang expressions (https://expr-lang.org) against the same root as templates:
+//
+//	Req.Query.age >= 18 && Step.auth.Data.StatusCode == 200
+//	Step.mysql.Data.Query.q[0].total * 1.1
+//	lower(Req.Header.role) in ["admin", "owner"] ? "full" : "limited"
+//
+// A missing map key is nil, members of a nil value are read with ?., ex: Req.Json.user?.name. Comparisons read
+// a numeric string as a number when the other side is a number, query, header and form values being strings.
+// The expr builtins are available, plus the template functions expr has no builtin for, ex: substr 0 2 s.
+type exprEvaluator struct {
+	cache *lruCache[*vm.Program]
+}
+
+// NewExprEvaluator returns the built-in expression evaluator.
+func NewExprEvaluator() IEvaluator {
+	return &exprEvaluator{cache: newLRUCache[*vm.Program](compiledCacheSize)}
+}
+
+func (e *exprEvaluator) Evaluate(expression string, env any) (any, error) {
+	program, err := e.cache.getOrCompile(expression, compileExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	return expr.Run(program, env)
+}
+
+func (e *exprEvaluator) References(expression string) ([]string, error) {
+	program, err := e.cache.getOrCompile(expression, compileExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := &exprReferences{chains: make(map[ast.Node]string)}
+	node := program.Node()
+	ast.Walk(&node, collector)
+
+	result := make([]string, 0, len(collector.chains))
+	for _, chain := range collector.chains {
+		result = append(result, chain)
+	}
+
+	return result, nil
+}
+
+// exprCompareFuncName is the function the comparisons are patched into, the name can't be written in an expression.
+const exprCompareFuncName = "$compare"
+
+var exprOptions = func() []expr.Option {
+	opts := []expr.Option{
+		expr.Patch(exprComparePatcher{}),
+		expr.Function(exprCompareFuncName, func(params ...any) (any, error) {
+			return exprCompare(params[0].(string), params[1], params[2])
+		}, new(func(string, any, any) bool)),
+	}
+
+	for name, fn := range templateFuncs {
+		if _, isBuiltin := builtin.Index[name]; isBuiltin {
+			continue
+		}
+		opts = append(opts, expr.Function(name, exprFunc(name, reflect.ValueOf(fn))))
+	}
+
+	return opts
+}()
+
+func compileExpr(expression string) (*vm.Program, error) {
+	return expr.Compile(expression, exprOptions...)
+}
+
+// exprFunc calls a template function with the arguments converted to its parameter types.
+func exprFunc(name string, fn reflect.Value) func(params ...any) (any, error) {
+	fnType := fn.Type()
+
+	return func(params ...any) (any, error) {
+		if (!fnType.IsVariadic() && len(params) != fnType.NumIn()) || (fnType.IsVariadic() && len(params) < fnType.NumIn()-1) {
+			return nil, fmt.Errorf("function %s: wrong number of arguments %d", name, len(params))
+		}
+
+		args := make([]reflect.Value, 0, len(params))
+		for i, param := range params {
+			var paramType reflect.Type
+			if fnType.IsVariadic() && i >= fnType.NumIn()-1 {
+				paramType = fnType.In(fnType.NumIn() - 1).Elem()
+			} else {
+				paramType = fnType.In(i)
+			}
+
+			arg, err := convertExprArg(param, paramType)
+			if err != nil {
+				return nil, fmt.Errorf("function %s argument %d: %w", name, i+1, err)
+			}
+			args = append(args, arg)
+		}
+
+		results := fn.Call(args)
+		if len(results) == 2 && !results[1].IsNil() {
+			return nil, fmt.Errorf("function %s: %w", name, results[1].Interface().(error))
+		}
+
+		return valueInterface(results[0]), nil
+	}
+}
+
+func convertExprArg(arg any, paramType reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(paramType), nil
+	}
+
+	argValue := reflect.ValueOf(arg)
+	if argValue.Type().AssignableTo(paramType) {
+		return argValue, nil
+	}
+
+	var (
+		converted any
+		err       error
+	)
+	switch paramType.Kind() {
+	case reflect.String:
+		converted, err = cast.ToStringE(arg)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		converted, err = cast.ToInt64E(arg)
+	case reflect.Float32, reflect.Float64:
+		converted, err = cast.ToFloat64E(arg)
+	case reflect.Bool:
+		converted, err = cast.ToBoolE(arg)
+	default:
+		return reflect.Value{}, fmt.Errorf("can't use %T as %s", arg, paramType)
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return reflect.ValueOf(converted).Convert(paramType), nil
+}
+
+// exprComparePatcher replaces the comparison operators with a call of exprCompare.
+type exprComparePatcher struct{}
+
+func (exprComparePatcher) Visit(node *ast.Node) {
+	binary, ok := (*node).(*ast.BinaryNode)
+	if !ok {
+		return
+	}
+
+	switch binary.Operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+		ast.Patch(node, &ast.CallNode{
+			Callee:    &ast.IdentifierNode{Value: exprCompareFuncName},
+			Arguments: []ast.Node{&ast.StringNode{Value: binary.Operator}, binary.Left, binary.Right},
+		})
+	}
+}
+
+// exprCompare compares two values like expr does, a numeric string compared with a number is read as a number.
+func exprCompare(operator string, left, right any) (result bool, err error) {
+	left, right = exprNumeric(left, right), exprNumeric(right, left)
+
+	// the expr runtime panics on values that can't be compared
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	switch operator {
+	case "==":
+		return runtime.Equal(left, right), nil
+	case "!=":
+		return !runtime.Equal(left, right), nil
+	case "<":
+		return runtime.Less(left, right), nil
+	case "<=":
+		return runtime.LessOrEqual(left, right), nil
+	case ">":
+		return runtime.More(left, right), nil
+	case ">=":
+		return runtime.MoreOrEqual(left, right), nil
+	}
+
+	return false, fmt.Errorf("unknown operator %s", operator)
+}
+
+// exprNumeric returns the number of a numeric string when the other value is a number, the value otherwise.
+func exprNumeric(value, other any) any {
+	s, ok := value.(string)
+	if !ok || !isNumberValue(other) {
+		return value
+	}
+
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n
+	}
+	return value
+}
+
+func isNumberValue(value any) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// exprReferences collects the member chains starting from the root, ex: Req.Query.age. The nodes are visited
+// children first, a chain replaces the chain of its object.
+type exprReferences struct {
+	chains map[ast.Node]string
+}
+
+func (r *exprReferences) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.CallNode:
+		delete(r.chains, n.Callee) // function name
+		return
+	case *ast.MemberNode:
+		if exprMemberChain(n) != "" {
+			delete(r.chains, n.Node)
+		}
+	case *ast.ChainNode:
+		delete(r.chains, n.Node)
+	}
+
+	if chain := exprMemberChain(*node); chain != "" {
+		r.chains[*node] = chain
+	}
+}
+
+func exprMemberChain(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return n.Value
+	case *ast.ChainNode:
+		return exprMemberChain(n.Node)
+	case *ast.MemberNode:
+		if property, ok := n.Property.(*ast.StringNode); ok {
+			if chain := exprMemberChain(n.Node); chain != "" {
+				return chain + "." + property.Value
+			}
+		}
+	}
+	return ""
+}
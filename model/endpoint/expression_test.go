@@ -0,0 +1,180 @@
+package endpoint
+
+import (
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expression", func() {
+	mockStepId := "mockStepId"
+
+	newCtxData := func() *entityContext.ContextData {
+		return &entityContext.ContextData{
+			Req: entityContext.ContextRequestData{
+				Query: map[string]any{
+					"age":   20,
+					"name":  "John",
+					"role":  "ADMIN",
+					"count": "21",
+				},
+			},
+			Step: map[string]entityContext.ContextStepData{
+				"auth": {
+					Data: entityContext.ContextStepDataBody{StatusCode: 200},
+				},
+				"mysql": {
+					Data: entityContext.ContextStepDataBody{
+						Query: map[string]any{
+							"q": []map[string]any{
+								{"total": 10},
+								{"total": 2.5},
+							},
+						},
+					},
+				},
+				mockStepId: {
+					Var: map[string]any{"tags": []any{"a", "b"}},
+				},
+			},
+		}
+	}
+
+	DescribeTable("Evaluate", func(expression string, want any) {
+		got, err := NewExprEvaluator().Evaluate(expression, newVariableData(mockStepId, newCtxData(), newOptions(nil)))
+		Expect(err).To(BeNil())
+		if want == nil {
+			Expect(got).To(BeNil())
+		} else {
+			Expect(got).To(Equal(want))
+		}
+	},
+		Entry("literal int", "42", 42),
+		Entry("literal float", "1.5", 1.5),
+		Entry("literal string", `'it\'s'`, "it's"),
+		Entry("literal nil", "nil", nil),
+		Entry("member", "Req.Query.name", "John"),
+		Entry("missing key", "Req.Query.unknown", nil),
+		Entry("optional member", "Req.Query.unknown?.deep", nil),
+		Entry("index", `Step.mysql.Data.Query.q[-1]["total"]`, 2.5),
+		Entry("arithmetic keeps int", "Req.Query.age * 2 + 1", 41),
+		Entry("arithmetic with float", "Step.mysql.Data.Query.q[0].total * 1.5", 15.0),
+		Entry("precedence", "(1 + 2) * 3 - 4 % 3", 8),
+		Entry("unary minus", "-Req.Query.age", -20),
+		Entry("string concat", "Req.Query.name + '!'", "John!"),
+		Entry("comparison", "Req.Query.age >= 18 && Step.auth.Data.StatusCode == 200", true),
+		Entry("comparison across number types", "Step.mysql.Data.Query.q[0].total == 10.0", true),
+		Entry("numeric string compared with a number", "Req.Query.count >= 18 && Req.Query.count == 21.0", true),
+		Entry("numeric string compared with a string", "Req.Query.count == '21.0'", false),
+		Entry("short circuit", "Req.Query.unknown != nil && Req.Query.unknown.x > 1", false),
+		Entry("not", "!(Req.Query.age < 18)", true),
+		Entry("in list", "'b' in Var.tags", true),
+		Entry("in map", "'name' in Req.Query", true),
+		Entry("ternary", "lower(Req.Query.role) in ['admin', 'owner'] ? 'full' : 'limited'", "full"),
+		Entry("function", "upper(Req.Query.name)", "JOHN"),
+		Entry("function with conversion", "substr(0, 2, Req.Query.age)", "20"),
+		Entry("len", "len(Step.mysql.Data.Query.q)", 2),
+		Entry("list", "[1, 'a']", []any{1, "a"}),
+	)
+
+	DescribeTable("Evaluate errors", func(expression string, wantErr string) {
+		_, err := NewExprEvaluator().Evaluate(expression, newVariableData(mockStepId, newCtxData(), newOptions(nil)))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(wantErr))
+	},
+		Entry("unterminated", "Req.Query.age >", "unexpected token EOF"),
+		Entry("trailing token", "1 2", `unexpected token Number("2")`),
+		Entry("unknown function", "unknown(1)", "cannot fetch unknown"),
+		Entry("member of nil", "Req.Query.unknown.deep", "cannot fetch deep"),
+		Entry("division by zero", "1 % 0", "integer divide by zero"),
+		Entry("wrong argument count", "upper(1, 2)", "too many arguments"),
+		Entry("template function argument", "substr('a', 2, 'abc')", "function substr argument 1"),
+		Entry("invalid comparison", "Req.Query.name > [1]", "invalid operation"),
+		Entry("non numeric string compared with a number", "Req.Query.name > 1", "invalid operation"),
+	)
+
+	It("GetValue with an expression", func() {
+		variable := &Variable{Value: "expr: Req.Query.age >= 18"}
+		value, err := variable.GetValue(mockStepId, newCtxData(), WithSyntax(SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(value).To(Equal(true))
+
+		variable = &Variable{Value: "expr:Req.Query.age + 1", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}
+		value, err = variable.GetValue(mockStepId, newCtxData(), WithSyntax(SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(value).To(Equal("21"))
+	})
+
+	It("GetValue without SyntaxExpression keeps the value", func() {
+		variable := &Variable{Value: "expr:Req.Query.age >= 18"}
+		value, err := variable.GetValue(mockStepId, newCtxData())
+		Expect(err).To(BeNil())
+		Expect(value).To(Equal("expr:Req.Query.age >= 18"))
+
+		references, err := variable.References()
+		Expect(err).To(BeNil())
+		Expect(references).To(BeEmpty())
+	})
+
+	It("GetValue with an invalid expression returns the variable error", func() {
+		variable := &Variable{Value: "expr:Req.Query.age >"}
+		_, err := variable.GetValue(mockStepId, newCtxData(), WithSyntax(SyntaxExpression), WithName("adult"))
+
+		var variableErr *VariableError
+		Expect(err).To(BeAssignableToTypeOf(variableErr))
+		Expect(err.(*VariableError).Name).To(Equal("adult"))
+	})
+
+	It("RegisterEvaluator", func() {
+		RegisterEvaluator("upper", evaluatorFunc(func(expression string, env any) (any, error) {
+			return expression + "!", nil
+		}))
+		DeferCleanup(func() {
+			RegisterEvaluator("upper", nil)
+		})
+
+		variable := &Variable{Value: "upper: hello"}
+		value, err := variable.GetValue(mockStepId, newCtxData(), WithSyntax(SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(value).To(Equal("hello!"))
+
+		references, err := variable.References(WithSyntax(SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(references).To(BeEmpty())
+	})
+
+	It("References", func() {
+		variable := &Variable{Value: "expr:Step.mysql.Data.Query.q[Var.i].total > 1 || upper(Req.Query.name) == 'X'"}
+		references, err := variable.References(WithSyntax(SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(references).To(Equal([]string{"Req.Query.name", "Step.mysql.Data.Query.q", "Var.i"}))
+
+		variable = &Variable{Value: "expr:Req.Json.user?.name ?? Global.names[Var.i]"}
+		references, err = variable.References(WithSyntax(SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(references).To(Equal([]string{"Global.names", "Req.Json.user.name", "Var.i"}))
+	})
+
+	DescribeTable("EvaluateCondition", func(condition string, want bool) {
+		got, err := EvaluateCondition(mockStepId, newCtxData(), condition, WithSyntax(SyntaxPath|SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(want))
+	},
+		Entry("empty", "", false),
+		Entry("expression", "expr:Step.auth.Data.StatusCode == 200", true),
+		Entry("template", "{{eq .Step.auth.Data.StatusCode 404}}", false),
+		Entry("path", "$.Step.auth.Data.StatusCode", true),
+	)
+
+	It("EvaluateCondition with a non boolean value", func() {
+		_, err := EvaluateCondition(mockStepId, newCtxData(), "expr:Req.Query.name", WithSyntax(SyntaxExpression))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+type evaluatorFunc func(expression string, env any) (any, error)
+
+func (f evaluatorFunc) Evaluate(expression string, env any) (any, error) {
+	return f(expression, env)
+}
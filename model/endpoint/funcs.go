@@ -0,0 +1,606 @@
+package endpoint
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	"github.com/spf13/cast"
+)
+
+// templateFuncs is the function set registered on every variable template. Functions taking the value to
+// operate on accept it as the last argument so they can be used in pipelines, ex: {{.Req.Query.name | upper}}.
+//
+// Strings:
+//
+//	lower s, upper s, title s, trim s, trimPrefix prefix s, trimSuffix suffix s, replace old new s,
+//	contains substr s, hasPrefix prefix s, hasSuffix suffix s, split sep s, join sep list,
+//	substr start end s, repeat count s, quote s
+//
+// Math (integers stay int64 unless a float is involved):
+//
+//	add a b, sub a b, mul a b, div a b, mod a b, max a b..., min a b..., abs n, round n, floor n, ceil n
+//
+// Defaults and conditions:
+//
+//	default fallback value, coalesce values..., empty value, ternary whenTrue whenFalse condition
+//
+// Date (layouts use Go reference time, "RFC3339" and friends are accepted by name):
+//
+//	now, unixTime t, formatTime layout t, parseTime layout s, addDuration duration t
+//
+// Encoding and hashing:
+//
+//	b64enc s, b64dec s, hexEnc s, hexDec s, sha1 s, sha256 s, hmacSha256 key s, toJson v, fromJson s
+//
+// Lists and maps:
+//
+//	list values..., first list, last list, append list value, has value list, reverse list, uniq list,
+//	sortAlpha list, dict key value..., get key map, keys map
+//
+// Headers (names are case-insensitive, the source is .Req or a header map, .Req.Header.<Name> needs the canonical
+// name, ex: .Req.Header.Authorization):
+//
+//	header name source, headerValues name source
+//
+// Conversion:
+//
+//	toString v, toInt v, toFloat v, toBool v
+var templateFuncs = template.FuncMap{
+	// strings
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"title":      funcTitle,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []any { return funcToList(strings.Split(s, sep)) },
+	"join":       funcJoin,
+	"substr":     funcSubstr,
+	"repeat":     funcRepeat,
+	"quote":      func(value any) string { return fmt.Sprintf("%q", cast.ToString(value)) },
+
+	// math
+	"add":   func(a, b any) (any, error) { return funcArithmetic("add", a, b) },
+	"sub":   func(a, b any) (any, error) { return funcArithmetic("sub", a, b) },
+	"mul":   func(a, b any) (any, error) { return funcArithmetic("mul", a, b) },
+	"div":   func(a, b any) (any, error) { return funcArithmetic("div", a, b) },
+	"mod":   func(a, b any) (any, error) { return funcArithmetic("mod", a, b) },
+	"max":   func(values ...any) (any, error) { return funcExtreme(1, values) },
+	"min":   func(values ...any) (any, error) { return funcExtreme(-1, values) },
+	"abs":   funcAbs,
+	"round": func(value any) (float64, error) { return funcFloatOp(math.Round, value) },
+	"floor": func(value any) (float64, error) { return funcFloatOp(math.Floor, value) },
+	"ceil":  func(value any) (float64, error) { return funcFloatOp(math.Ceil, value) },
+
+	// defaults and conditions
+	"default":  funcDefault,
+	"coalesce": funcCoalesce,
+	"empty":    funcEmpty,
+	"ternary":  funcTernary,
+
+	// date
+	"now":         time.Now,
+	"unixTime":    funcUnixTime,
+	"formatTime":  funcFormatTime,
+	"parseTime":   funcParseTime,
+	"addDuration": funcAddDuration,
+
+	// encoding and hashing
+	"b64enc":     func(value any) string { return base64.StdEncoding.EncodeToString([]byte(cast.ToString(value))) },
+	"b64dec":     funcB64Dec,
+	"hexEnc":     func(value any) string { return hex.EncodeToString([]byte(cast.ToString(value))) },
+	"hexDec":     funcHexDec,
+	"sha1":       funcSha1,
+	"sha256":     funcSha256,
+	"hmacSha256": funcHmacSha256,
+	"toJson":     funcToJson,
+	"fromJson":   funcFromJson,
+
+	// lists and maps
+	"list":      func(values ...any) []any { return values },
+	"first":     funcFirst,
+	"last":      funcLast,
+	"append":    funcAppend,
+	"has":       funcHas,
+	"reverse":   funcReverse,
+	"uniq":      funcUniq,
+	"sortAlpha": funcSortAlpha,
+	"dict":      funcDict,
+	"get":       funcGet,
+	"keys":      funcKeys,
+
+	// headers
+	"header":       funcHeader,
+	"headerValues": funcHeaderValues,
+
+	// conversion
+	"toString": cast.ToStringE,
+	"toInt":    cast.ToInt64E,
+	"toFloat":  cast.ToFloat64E,
+	"toBool":   cast.ToBoolE,
+}
+
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+func funcTitle(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToTitle(first)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+func funcJoin(sep string, list any) (string, error) {
+	values, err := funcListValues(list)
+	if err != nil {
+		return "", err
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, cast.ToString(value))
+	}
+
+	return strings.Join(result, sep), nil
+}
+
+func funcSubstr(start, end int, s string) string {
+	runes := []rune(s)
+	start, end = max(0, min(start, len(runes))), min(end, len(runes))
+	if end < 0 {
+		end = len(runes)
+	}
+	if start > end {
+		return ""
+	}
+	return string(runes[start:end])
+}
+
+// maxRepeatLength bounds repeat, its result is built in memory before any output limit applies.
+const maxRepeatLength = 1 << 20
+
+func funcRepeat(count int, s string) (string, error) {
+	count = max(count, 0)
+	if len(s) > 0 && count > maxRepeatLength/len(s) {
+		return "", fmt.Errorf("%w: repeat result larger than %d bytes", ErrOutputTooLarge, maxRepeatLength)
+	}
+	return strings.Repeat(s, count), nil
+}
+
+func funcArithmetic(operation string, a, b any) (any, error) {
+	if isInteger(a) && isInteger(b) {
+		left, right := cast.ToInt64(a), cast.ToInt64(b)
+		switch operation {
+		case "add":
+			return left + right, nil
+		case "sub":
+			return left - right, nil
+		case "mul":
+			return left * right, nil
+		case "div", "mod":
+			if right == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if operation == "mod" {
+				return left % right, nil
+			}
+			return left / right, nil
+		}
+	}
+
+	left, err := cast.ToFloat64E(a)
+	if err != nil {
+		return nil, err
+	}
+	right, err := cast.ToFloat64E(b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation {
+	case "add":
+		return left + right, nil
+	case "sub":
+		return left - right, nil
+	case "mul":
+		return left * right, nil
+	case "div", "mod":
+		if right == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if operation == "mod" {
+			return math.Mod(left, right), nil
+		}
+		return left / right, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation %s", operation)
+}
+
+func isInteger(value any) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// funcExtreme returns the greatest value when sign is 1 and the smallest when sign is -1.
+func funcExtreme(sign int, values []any) (any, error) {
+	if len(values) == 0 {
+		return nil, errors.New("at least one value is required")
+	}
+
+	result := values[0]
+	for _, value := range values[1:] {
+		compared, ok := compareOrdered(value, result)
+		if !ok {
+			return nil, fmt.Errorf("can't compare %T with %T", value, result)
+		}
+		if compared*sign > 0 {
+			result = value
+		}
+	}
+
+	return result, nil
+}
+
+func funcAbs(value any) (any, error) {
+	if isInteger(value) {
+		number := cast.ToInt64(value)
+		if number < 0 {
+			return -number, nil
+		}
+		return number, nil
+	}
+	return funcFloatOp(math.Abs, value)
+}
+
+func funcFloatOp(operation func(float64) float64, value any) (float64, error) {
+	number, err := cast.ToFloat64E(value)
+	if err != nil {
+		return 0, err
+	}
+	return operation(number), nil
+}
+
+func funcDefault(fallback, value any) any {
+	if funcEmpty(value) {
+		return fallback
+	}
+	return value
+}
+
+func funcCoalesce(values ...any) any {
+	for _, value := range values {
+		if !funcEmpty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+func funcEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return reflectValue.Len() == 0
+	}
+
+	return reflectValue.IsZero()
+}
+
+func funcTernary(whenTrue, whenFalse any, condition bool) any {
+	if condition {
+		return whenTrue
+	}
+	return whenFalse
+}
+
+func funcTimeLayout(layout string) string {
+	if namedLayout, ok := timeLayouts[layout]; ok {
+		return namedLayout
+	}
+	return layout
+}
+
+func funcToTime(value any) (time.Time, error) {
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	return cast.ToTimeE(value)
+}
+
+func funcUnixTime(value any) (int64, error) {
+	t, err := funcToTime(value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+func funcFormatTime(layout string, value any) (string, error) {
+	t, err := funcToTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(funcTimeLayout(layout)), nil
+}
+
+func funcParseTime(layout string, value string) (time.Time, error) {
+	return time.Parse(funcTimeLayout(layout), value)
+}
+
+func funcAddDuration(duration string, value any) (time.Time, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := funcToTime(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.Add(d), nil
+}
+
+func funcB64Dec(value any) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cast.ToString(value))
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+func funcHexDec(value any) (string, error) {
+	decoded, err := hex.DecodeString(cast.ToString(value))
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+func funcSha1(value any) string {
+	digest := sha1.Sum([]byte(cast.ToString(value)))
+	return hex.EncodeToString(digest[:])
+}
+
+func funcSha256(value any) string {
+	digest := sha256.Sum256([]byte(cast.ToString(value)))
+	return hex.EncodeToString(digest[:])
+}
+
+func funcHmacSha256(key, value any) string {
+	mac := hmac.New(sha256.New, []byte(cast.ToString(key)))
+	mac.Write([]byte(cast.ToString(value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func funcToJson(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func funcFromJson(value string) (any, error) {
+	var result any
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func funcToList[T any](values []T) []any {
+	result := make([]any, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+func funcListValues(list any) ([]any, error) {
+	if list == nil {
+		return nil, nil
+	}
+
+	reflectValue := reflect.ValueOf(list)
+	if !isListValue(reflectValue) {
+		return nil, fmt.Errorf("expected list, got %T", list)
+	}
+
+	result := make([]any, 0, reflectValue.Len())
+	for i := 0; i < reflectValue.Len(); i++ {
+		result = append(result, reflectValue.Index(i).Interface())
+	}
+
+	return result, nil
+}
+
+func funcFirst(list any) (any, error) {
+	values, err := funcListValues(list)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+func funcLast(list any) (any, error) {
+	values, err := funcListValues(list)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return values[len(values)-1], nil
+}
+
+func funcAppend(list any, value any) ([]any, error) {
+	values, err := funcListValues(list)
+	if err != nil {
+		return nil, err
+	}
+	return append(values, value), nil
+}
+
+func funcHas(value any, list any) (bool, error) {
+	values, err := funcListValues(list)
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range values {
+		if compareEqual(item, value) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func funcReverse(list any) ([]any, error) {
+	values, err := funcListValues(list)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[len(values)-1-i] = value
+	}
+
+	return result, nil
+}
+
+func funcUniq(list any) ([]any, error) {
+	values, err := funcListValues(list)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]any, 0, len(values))
+	for _, value := range values {
+		if found, _ := funcHas(value, result); !found {
+			result = append(result, value)
+		}
+	}
+
+	return result, nil
+}
+
+func funcSortAlpha(list any) ([]string, error) {
+	values, err := funcListValues(list)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, cast.ToString(value))
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func funcDict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict requires an even number of arguments")
+	}
+
+	result := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		result[cast.ToString(pairs[i])] = pairs[i+1]
+	}
+
+	return result, nil
+}
+
+func funcGet(key string, value any) any {
+	return valueInterface(childValue(indirectValue(reflect.ValueOf(value)), key))
+}
+
+// funcHeader returns the first value of a header, ex: {{header "authorization" .Req}}.
+func funcHeader(name string, source any) (string, error) {
+	values, err := funcHeaderValues(name, source)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return cast.ToString(values[0]), nil
+}
+
+// funcHeaderValues returns every value of a repeated header, ex:
+// {{headerValues "x-forwarded-for" .Req | join ","}}.
+func funcHeaderValues(name string, source any) ([]any, error) {
+	var req entityContext.ContextRequestData
+
+	switch typed := source.(type) {
+	case entityContext.ContextRequestData:
+		req = typed
+	case *entityContext.ContextRequestData:
+		if typed != nil {
+			req = *typed
+		}
+	case map[string]any:
+		req.Header = typed
+	case map[string][]string:
+		req.HeaderValues = typed
+	case nil:
+	default:
+		return nil, fmt.Errorf("expected request or header map, got %T", source)
+	}
+
+	return funcToList(req.GetHeaderValues(name)), nil
+}
+
+func funcKeys(value any) ([]string, error) {
+	reflectValue := indirectValue(reflect.ValueOf(value))
+	if reflectValue.Kind() != reflect.Map {
+		return nil, fmt.Errorf("expected map, got %T", value)
+	}
+
+	result := make([]string, 0, reflectValue.Len())
+	for _, key := range reflectValue.MapKeys() {
+		result = append(result, fmt.Sprint(key.Interface()))
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
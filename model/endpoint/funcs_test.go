@@ -0,0 +1,148 @@
+package endpoint
+
+import (
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template Functions", func() {
+	mockStepId := "mockStepId"
+
+	mockCtxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Header: map[string]any{"X-Forwarded-For": "10.0.0.1", "x-lower": "lower"},
+			HeaderValues: map[string][]string{
+				"X-Forwarded-For": {"10.0.0.1", "10.0.0.2"},
+			},
+			Query: map[string]any{
+				"name":   "  John Doe  ",
+				"age":    17,
+				"price":  10.5,
+				"tags":   "b,a,b,c",
+				"empty":  "",
+				"secret": "key",
+				"date":   "2024-01-02T03:04:05Z",
+			},
+			Json: map[string]any{
+				"items":  []any{"x", "y", "z"},
+				"object": map[string]any{"b": 2, "a": 1},
+				"raw":    `{"id":7}`,
+			},
+		},
+		Step: map[string]entityContext.ContextStepData{
+			mockStepId: {},
+		},
+	}
+
+	runTest := func(value string, wantResult any, wantErr bool) {
+		variable := &Variable{Value: value, Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}
+		got, err := variable.GetValue(mockStepId, mockCtxData)
+
+		if wantResult == nil {
+			Expect(got).To(BeNil())
+		} else {
+			Expect(got).To(Equal(wantResult))
+		}
+
+		if wantErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).To(BeNil())
+		}
+	}
+
+	DescribeTable("Strings", runTest,
+		Entry("lower", `{{.Req.Query.name | trim | lower}}`, "john doe", false),
+		Entry("upper", `{{.Req.Query.name | trim | upper}}`, "JOHN DOE", false),
+		Entry("title", `{{title "hello world"}}`, "Hello World", false),
+		Entry("title - multibyte", `{{title "élan ǆungla"}}`, "Élan ǅungla", false),
+		Entry("trimPrefix", `{{trimPrefix "Bearer " "Bearer token"}}`, "token", false),
+		Entry("trimSuffix", `{{trimSuffix ".json" "file.json"}}`, "file", false),
+		Entry("replace", `{{replace "-" "_" "a-b-c"}}`, "a_b_c", false),
+		Entry("contains", `{{contains "Doe" .Req.Query.name}}`, "true", false),
+		Entry("hasPrefix", `{{hasPrefix "ab" "abc"}}`, "true", false),
+		Entry("hasSuffix", `{{hasSuffix "ab" "abc"}}`, "false", false),
+		Entry("split and join", `{{split "," .Req.Query.tags | join "|"}}`, "b|a|b|c", false),
+		Entry("substr", `{{substr 1 3 "abcdef"}}`, "bc", false),
+		Entry("repeat", `{{repeat 3 "ab"}}`, "ababab", false),
+		Entry("quote", `{{quote "a"}}`, `"a"`, false),
+	)
+
+	DescribeTable("Math", runTest,
+		Entry("add int", `{{add .Req.Query.age 1}}`, "18", false),
+		Entry("add float", `{{add .Req.Query.price 1}}`, "11.5", false),
+		Entry("sub", `{{sub 10 4}}`, "6", false),
+		Entry("mul", `{{mul .Req.Query.price 2}}`, "21", false),
+		Entry("div int", `{{div 7 2}}`, "3", false),
+		Entry("div float", `{{div 7.0 2}}`, "3.5", false),
+		Entry("div by zero", `{{div 7 0}}`, nil, false),
+		Entry("mod", `{{mod 7 3}}`, "1", false),
+		Entry("max", `{{max 3 9 4}}`, "9", false),
+		Entry("min", `{{min 3 9 4}}`, "3", false),
+		Entry("abs", `{{abs -5}}`, "5", false),
+		Entry("round", `{{round 2.5}}`, "3", false),
+		Entry("floor", `{{floor 2.7}}`, "2", false),
+		Entry("ceil", `{{ceil 2.1}}`, "3", false),
+	)
+
+	DescribeTable("Defaults and conditions", runTest,
+		Entry("default - empty", `{{.Req.Query.empty | default "anonymous"}}`, "anonymous", false),
+		Entry("default - missing", `{{.Req.Query.unknown | default "anonymous"}}`, "anonymous", false),
+		Entry("default - present", `{{.Req.Query.age | default 1}}`, "17", false),
+		Entry("coalesce", `{{coalesce .Req.Query.unknown .Req.Query.empty "last"}}`, "last", false),
+		Entry("empty", `{{empty .Req.Query.empty}}`, "true", false),
+		Entry("ternary", `{{ternary "adult" "minor" (ge .Req.Query.age 18)}}`, "minor", false),
+	)
+
+	DescribeTable("Date", runTest,
+		Entry("parseTime and formatTime", `{{parseTime "RFC3339" .Req.Query.date | formatTime "2006/01/02"}}`, "2024/01/02", false),
+		Entry("unixTime", `{{unixTime .Req.Query.date}}`, "1704164645", false),
+		Entry("addDuration", `{{addDuration "1h" .Req.Query.date | formatTime "DateTime"}}`, "2024-01-02 04:04:05", false),
+		Entry("now", `{{now | formatTime "2006" | len}}`, "4", false),
+		Entry("invalid time", `{{parseTime "RFC3339" "not a date"}}`, nil, false),
+	)
+
+	DescribeTable("Encoding and hashing", runTest,
+		Entry("b64enc", `{{b64enc "hello"}}`, "aGVsbG8=", false),
+		Entry("b64dec", `{{b64dec "aGVsbG8="}}`, "hello", false),
+		Entry("hexEnc", `{{hexEnc "hi"}}`, "6869", false),
+		Entry("hexDec", `{{hexDec "6869"}}`, "hi", false),
+		Entry("sha1", `{{sha1 "hello"}}`, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", false),
+		Entry("sha256", `{{sha256 "hello"}}`, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", false),
+		Entry("hmacSha256", `{{hmacSha256 .Req.Query.secret "hello"}}`, "9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b", false),
+		Entry("toJson", `{{toJson .Req.Json.object}}`, `{"a":1,"b":2}`, false),
+		Entry("fromJson", `{{(fromJson .Req.Json.raw).id}}`, "7", false),
+	)
+
+	DescribeTable("Lists and maps", runTest,
+		Entry("list", `{{list 1 2 | len}}`, "2", false),
+		Entry("first", `{{first .Req.Json.items}}`, "x", false),
+		Entry("last", `{{last .Req.Json.items}}`, "z", false),
+		Entry("append", `{{append .Req.Json.items "w" | join ","}}`, "x,y,z,w", false),
+		Entry("has", `{{has "y" .Req.Json.items}}`, "true", false),
+		Entry("reverse", `{{reverse .Req.Json.items | join ","}}`, "z,y,x", false),
+		Entry("uniq", `{{split "," .Req.Query.tags | uniq | join ","}}`, "b,a,c", false),
+		Entry("sortAlpha", `{{split "," .Req.Query.tags | sortAlpha | join ","}}`, "a,b,b,c", false),
+		Entry("dict and get", `{{dict "k" "v" | get "k"}}`, "v", false),
+		Entry("keys", `{{keys .Req.Json.object | join ","}}`, "a,b", false),
+	)
+
+	DescribeTable("Headers", runTest,
+		Entry("header", `{{header "x-forwarded-for" .Req}}`, "10.0.0.1", false),
+		Entry("headerValues", `{{headerValues "X-FORWARDED-FOR" .Req | join ","}}`, "10.0.0.1,10.0.0.2", false),
+		Entry("header of a header map", `{{header "x-forwarded-for" .Req.Header}}`, "10.0.0.1", false),
+		Entry("header not canonical", `{{header "X-Lower" .Req}}`, "lower", false),
+		Entry("header unknown", `{{header "authorization" .Req}}`, nil, false),
+		Entry("header method", `{{.Req.GetHeader "x-forwarded-for"}}`, "10.0.0.1", false),
+		Entry("header invalid source", `{{header "authorization" 1}}`, nil, false),
+	)
+
+	DescribeTable("Conversion", runTest,
+		Entry("toString", `{{toString .Req.Query.age | printf "%q"}}`, `"17"`, false),
+		Entry("toInt", `{{toInt "42" | add 1}}`, "43", false),
+		Entry("toFloat", `{{toFloat "1.5" | mul 2}}`, "3", false),
+		Entry("toBool", `{{toBool "true"}}`, "true", false),
+	)
+})
@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ideagate/core/model/constant"
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+)
+
+var (
+	// ErrUnknownJobType is returned for a job type without executor.
+	ErrUnknownJobType = errors.New("unknown job type")
+	// ErrInvalidJobConfig wraps the errors of IJobExecutor.Validate.
+	ErrInvalidJobConfig = errors.New("invalid job config")
+)
+
+// IJobExecutor executes the steps of a job type, ex: a query for mysql or a request for rest.
+type IJobExecutor interface {
+	// Validate checks the config of a step before it runs, ex: when a workflow is saved.
+	Validate(step *pbEndpoint.Step) error
+	// Execute runs the step and returns its data, ex: the rows of a query, set as the body of the step.
+	Execute(ctx context.Context, step *pbEndpoint.Step, ctxData *entityContext.ContextData) (any, error)
+}
+
+var (
+	jobExecutorsMutex sync.RWMutex
+	jobExecutors      = map[constant.JobType]IJobExecutor{}
+)
+
+// stepJobTypes are the job types of the built-in step types.
+var stepJobTypes = map[pbEndpoint.StepType]constant.JobType{
+	pbEndpoint.StepType_STEP_TYPE_START:      constant.JobTypeStart,
+	pbEndpoint.StepType_STEP_TYPE_END:        constant.JobTypeEnd,
+	pbEndpoint.StepType_STEP_TYPE_SLEEP:      constant.JobTypeSleep,
+	pbEndpoint.StepType_STEP_TYPE_SCRIPT_JS:  constant.JobTypeScriptJS,
+	pbEndpoint.StepType_STEP_TYPE_CONDITION:  constant.JobTypeCondition,
+	pbEndpoint.StepType_STEP_TYPE_REST:       constant.JobTypeRest,
+	pbEndpoint.StepType_STEP_TYPE_MYSQL:      constant.JobTypeMysql,
+	pbEndpoint.StepType_STEP_TYPE_POSTGRESQL: constant.JobTypePostgresql,
+	pbEndpoint.StepType_STEP_TYPE_REDIS:      constant.JobTypeRedis,
+}
+
+// RegisterJobExecutor makes an executor available for a job type, a built-in or a custom one, replacing the
+// executor already registered. A nil executor removes it.
+func RegisterJobExecutor(jobType constant.JobType, executor IJobExecutor) {
+	jobExecutorsMutex.Lock()
+	defer jobExecutorsMutex.Unlock()
+
+	if executor == nil {
+		delete(jobExecutors, jobType)
+		return
+	}
+	jobExecutors[jobType] = executor
+}
+
+// LookupJobExecutor returns the executor of a job type, ErrUnknownJobType when none is registered.
+func LookupJobExecutor(jobType constant.JobType) (IJobExecutor, error) {
+	jobExecutorsMutex.RLock()
+	defer jobExecutorsMutex.RUnlock()
+
+	executor, ok := jobExecutors[jobType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownJobType, jobType)
+	}
+	return executor, nil
+}
+
+// StepJobType returns the job type of a built-in step type.
+func StepJobType(stepType pbEndpoint.StepType) (constant.JobType, error) {
+	jobType, ok := stepJobTypes[stepType]
+	if !ok {
+		return "", fmt.Errorf("%w: step type %s", ErrUnknownJobType, stepType)
+	}
+	return jobType, nil
+}
+
+// ValidateJob checks the config of a step with the executor of its job type. The error matches
+// ErrInvalidJobConfig and the error of the executor.
+func ValidateJob(jobType constant.JobType, step *pbEndpoint.Step) error {
+	executor, err := LookupJobExecutor(jobType)
+	if err != nil {
+		return err
+	}
+
+	return validateJob(executor, step)
+}
+
+// ExecuteJob validates and runs a step with the executor of its job type.
+func ExecuteJob(ctx context.Context, jobType constant.JobType, step *pbEndpoint.Step, ctxData *entityContext.ContextData) (any, error) {
+	executor, err := LookupJobExecutor(jobType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validateJob(executor, step); err != nil {
+		return nil, err
+	}
+
+	return executor.Execute(ctx, step, ctxData)
+}
+
+func validateJob(executor IJobExecutor, step *pbEndpoint.Step) error {
+	if err := executor.Validate(step); err != nil {
+		return fmt.Errorf("%w: step %q: %w", ErrInvalidJobConfig, step.GetId(), err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ideagate/core/model/constant"
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// sleepExecutor is a job executor for the tests, it returns the duration of the sleep action.
+type sleepExecutor struct{}
+
+var errSleepAction = errors.New("sleep action is required")
+
+func (sleepExecutor) Validate(step *pbEndpoint.Step) error {
+	if step.GetAction().GetSleep() == nil {
+		return errSleepAction
+	}
+	return nil
+}
+
+func (sleepExecutor) Execute(_ context.Context, step *pbEndpoint.Step, ctxData *entityContext.ContextData) (any, error) {
+	return map[string]any{
+		"step":   step.GetId(),
+		"method": ctxData.GetRequest().Method,
+	}, nil
+}
+
+var _ = Describe("Job Executor", func() {
+	var (
+		ctx       = context.Background()
+		sleepStep = &pbEndpoint.Step{
+			Id:     "wait",
+			Type:   pbEndpoint.StepType_STEP_TYPE_SLEEP,
+			Action: &pbEndpoint.Action{Sleep: &pbEndpoint.ActionSleep{}},
+		}
+	)
+
+	BeforeEach(func() {
+		RegisterJobExecutor(constant.JobTypeSleep, sleepExecutor{})
+		DeferCleanup(func() {
+			RegisterJobExecutor(constant.JobTypeSleep, nil)
+		})
+	})
+
+	It("LookupJobExecutor", func() {
+		executor, err := LookupJobExecutor(constant.JobTypeSleep)
+		Expect(err).To(BeNil())
+		Expect(executor).To(Equal(sleepExecutor{}))
+
+		_, err = LookupJobExecutor("unknown")
+		Expect(err).To(MatchError(ErrUnknownJobType))
+		Expect(err.Error()).To(Equal(`unknown job type: "unknown"`))
+	})
+
+	It("RegisterJobExecutor - nil removes the executor", func() {
+		RegisterJobExecutor(constant.JobTypeSleep, nil)
+
+		_, err := LookupJobExecutor(constant.JobTypeSleep)
+		Expect(err).To(MatchError(ErrUnknownJobType))
+	})
+
+	It("StepJobType", func() {
+		jobType, err := StepJobType(pbEndpoint.StepType_STEP_TYPE_MYSQL)
+		Expect(err).To(BeNil())
+		Expect(jobType).To(Equal(constant.JobTypeMysql))
+
+		_, err = StepJobType(pbEndpoint.StepType_STEP_TYPE_UNSPECIFIED)
+		Expect(err).To(MatchError(ErrUnknownJobType))
+	})
+
+	It("ValidateJob", func() {
+		Expect(ValidateJob(constant.JobTypeSleep, sleepStep)).To(Succeed())
+
+		err := ValidateJob(constant.JobTypeSleep, &pbEndpoint.Step{Id: "wait"})
+		Expect(err).To(MatchError(ErrInvalidJobConfig))
+		Expect(err).To(MatchError(errSleepAction))
+		Expect(err.Error()).To(Equal(`invalid job config: step "wait": sleep action is required`))
+
+		Expect(ValidateJob(constant.JobTypeRedis, sleepStep)).To(MatchError(ErrUnknownJobType))
+	})
+
+	It("ExecuteJob", func() {
+		ctxData := &entityContext.ContextData{}
+		ctxData.SetRequestMethod("GET")
+
+		data, err := ExecuteJob(ctx, constant.JobTypeSleep, sleepStep, ctxData)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(map[string]any{"step": "wait", "method": "GET"}))
+
+		_, err = ExecuteJob(ctx, constant.JobTypeSleep, &pbEndpoint.Step{Id: "wait"}, ctxData)
+		Expect(err).To(MatchError(ErrInvalidJobConfig))
+
+		_, err = ExecuteJob(ctx, "custom", sleepStep, ctxData)
+		Expect(err).To(MatchError(ErrUnknownJobType))
+	})
+
+	It("ExecuteJob - custom job type", func() {
+		const jobTypeCustom constant.JobType = "custom"
+		RegisterJobExecutor(jobTypeCustom, jobExecutorFunc(func(ctx context.Context, step *pbEndpoint.Step, ctxData *entityContext.ContextData) (any, error) {
+			deadline, _ := ctx.Deadline()
+			return deadline, nil
+		}))
+		DeferCleanup(func() {
+			RegisterJobExecutor(jobTypeCustom, nil)
+		})
+
+		deadline := time.Now().Add(time.Minute)
+		timeoutCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+
+		data, err := ExecuteJob(timeoutCtx, jobTypeCustom, &pbEndpoint.Step{Id: "custom"}, &entityContext.ContextData{})
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(deadline))
+	})
+})
+
+// jobExecutorFunc is a job executor without config validation.
+type jobExecutorFunc func(ctx context.Context, step *pbEndpoint.Step, ctxData *entityContext.ContextData) (any, error)
+
+func (f jobExecutorFunc) Validate(*pbEndpoint.Step) error {
+	return nil
+}
+
+func (f jobExecutorFunc) Execute(ctx context.Context, step *pbEndpoint.Step, ctxData *entityContext.ContextData) (any, error) {
+	return f(ctx, step, ctxData)
+}
@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+)
+
+// Limits bounds the resources the evaluation of a variable value can use, a template, a path or an expression.
+// A zero value means unlimited.
+type Limits struct {
+	Timeout            time.Duration // wall-clock time of one execution
+	MaxOutputSize      int           // bytes of rendered output, the estimated size of a native value
+	MaxRangeIterations int           // iterations of every range in one execution, together, and nodes selected by paths
+}
+
+// DefaultLimits is a reasonable sandbox for templates written by end users, it's used unless WithLimits is set.
+var DefaultLimits = Limits{
+	Timeout:            100 * time.Millisecond,
+	MaxOutputSize:      1 << 20,
+	MaxRangeIterations: 10000,
+}
+
+var (
+	ErrNilContext      = errors.New("nil context")
+	ErrTemplateTimeout = errors.New("template execution timeout")
+	ErrOutputTooLarge  = errors.New("template output too large")
+	ErrRangeIterations = errors.New("template range iterations limit exceeded")
+)
+
+// executionState tracks the limits of one template execution.
+type executionState struct {
+	ctx        context.Context
+	limits     Limits
+	iterations int
+}
+
+// start applies the timeout of the limits to the execution, the returned function releases it.
+func (s *executionState) start() (context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if s.limits.Timeout > 0 {
+		s.ctx, cancel = context.WithTimeout(s.ctx, s.limits.Timeout)
+	}
+
+	return cancel, s.checkContext()
+}
+
+func (s *executionState) checkContext() error {
+	if err := s.ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %w", ErrTemplateTimeout, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// tick is called at the start of every range iteration and template call.
+func (s *executionState) tick(isIteration bool) error {
+	if err := s.checkContext(); err != nil {
+		return err
+	}
+
+	if !isIteration {
+		return nil
+	}
+
+	return s.iterate(1)
+}
+
+// iterate counts iterations, ex: the nodes selected by a path wildcard.
+func (s *executionState) iterate(count int) error {
+	s.iterations += count
+	if s.limits.MaxRangeIterations > 0 && s.iterations > s.limits.MaxRangeIterations {
+		return fmt.Errorf("%w: more than %d", ErrRangeIterations, s.limits.MaxRangeIterations)
+	}
+
+	return nil
+}
+
+// checkOutputSize bounds a native result, ex: of a single expression template, a path or an expression. Strings
+// and bytes count their length, other values their estimated size.
+func (s *executionState) checkOutputSize(value any) error {
+	maxSize := s.limits.MaxOutputSize
+	if maxSize <= 0 {
+		return nil
+	}
+
+	var size int64
+	switch typed := value.(type) {
+	case string:
+		size = int64(len(typed))
+	case []byte:
+		size = int64(len(typed))
+	default:
+		size = entityContext.EstimateSize(value)
+	}
+
+	if size > int64(maxSize) {
+		return fmt.Errorf("%w: more than %d bytes", ErrOutputTooLarge, maxSize)
+	}
+
+	return nil
+}
+
+// isLimitError tells whether err is caused by a limit, those errors are returned even without strict mode.
+func isLimitError(err error) bool {
+	return errors.Is(err, ErrTemplateTimeout) || errors.Is(err, ErrOutputTooLarge) ||
+		errors.Is(err, ErrRangeIterations) || errors.Is(err, context.Canceled)
+}
+
+// limitedWriter stops the execution when the output is too large or the context is done.
+type limitedWriter struct {
+	buffer bytes.Buffer
+	state  *executionState
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if err := w.state.checkContext(); err != nil {
+		return 0, err
+	}
+
+	if maxSize := w.state.limits.MaxOutputSize; maxSize > 0 && w.buffer.Len()+len(p) > maxSize {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrOutputTooLarge, maxSize)
+	}
+
+	return w.buffer.Write(p)
+}
@@ -0,0 +1,90 @@
+package endpoint
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limits", func() {
+	mockStepId := "mockStepId"
+
+	mockCtxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Query: map[string]any{
+				"count": 1000,
+				"rows":  []any{"a", "b", "c"},
+				"many":  make([]any, DefaultLimits.MaxRangeIterations+1),
+			},
+		},
+	}
+
+	runTest := func(value string, opts []Option, wantResult any, wantErr error) {
+		variable := &Variable{Value: value, Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}
+		got, err := variable.GetValue(mockStepId, mockCtxData, opts...)
+
+		if wantResult == nil {
+			Expect(got).To(BeNil())
+		} else {
+			Expect(got).To(Equal(wantResult))
+		}
+
+		if wantErr != nil {
+			Expect(err).To(MatchError(wantErr))
+		} else {
+			Expect(err).To(BeNil())
+		}
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	DescribeTable("GetValue", runTest,
+		Entry("within limits", `{{range 3}}a{{end}}`, []Option{WithLimits(DefaultLimits)}, "aaa", nil),
+		Entry("range iterations", `{{range .Req.Query.count}}{{end}}`,
+			[]Option{WithLimits(Limits{MaxRangeIterations: 100})}, nil, ErrRangeIterations),
+		Entry("nested range iterations are counted together", `{{range 20}}{{range 10}}{{end}}{{end}}`,
+			[]Option{WithLimits(Limits{MaxRangeIterations: 100})}, nil, ErrRangeIterations),
+		Entry("output size", `{{range .Req.Query.count}}abcdefghij{{end}}`,
+			[]Option{WithLimits(Limits{MaxOutputSize: 100})}, nil, ErrOutputTooLarge),
+		Entry("timeout without output", `{{range 100000000}}{{range 100000000}}{{end}}{{end}}`,
+			[]Option{WithLimits(Limits{Timeout: 10 * time.Millisecond})}, nil, ErrTemplateTimeout),
+		Entry("timeout in defined template", `{{define "loop"}}{{range 100000000}}{{end}}{{end}}{{template "loop"}}`,
+			[]Option{WithLimits(Limits{Timeout: 10 * time.Millisecond})}, nil, ErrTemplateTimeout),
+		Entry("canceled context", `{{range 3}}a{{end}}`, []Option{WithContext(canceledCtx)}, nil, context.Canceled),
+		Entry("repeat is bounded", `{{repeat 100000000 "abc"}}`, nil, nil, ErrOutputTooLarge),
+		Entry("default limits", "$.Req.Query.many[*]", []Option{WithSyntax(SyntaxPath)}, nil, ErrRangeIterations),
+		Entry("without limits", `{{range 10001}}{{end}}done`, []Option{WithLimits(Limits{})}, "done", nil),
+		Entry("single expression output size", `{{list "abcdefghij" "abcdefghij"}}`,
+			[]Option{WithLimits(Limits{MaxOutputSize: 50})}, nil, ErrOutputTooLarge),
+		Entry("path iterations", "$.Req.Query.rows[*]",
+			[]Option{WithSyntax(SyntaxPath), WithLimits(Limits{MaxRangeIterations: 2})}, nil, ErrRangeIterations),
+		Entry("path output size", "$.Req.Query.rows",
+			[]Option{WithSyntax(SyntaxPath), WithLimits(Limits{MaxOutputSize: 50})}, nil, ErrOutputTooLarge),
+		Entry("path canceled context", "$.Req.Query.rows",
+			[]Option{WithSyntax(SyntaxPath), WithContext(canceledCtx)}, nil, context.Canceled),
+		Entry("expression output size", "expr:Req.Query.rows",
+			[]Option{WithSyntax(SyntaxExpression), WithLimits(Limits{MaxOutputSize: 50})}, nil, ErrOutputTooLarge),
+		Entry("nil context", `{{range 3}}a{{end}}`, []Option{WithContext(nil)}, nil, ErrNilContext),
+	)
+
+	It("stops a recursive descent at the iterations limit", func() {
+		rows := make([]any, 1000)
+		for i := range rows {
+			rows[i] = map[string]any{"id": i, "tags": []any{"a", "b"}}
+		}
+
+		selection := &pathSelection{
+			state:       &executionState{ctx: context.Background(), limits: Limits{MaxRangeIterations: 10}},
+			isIteration: true,
+		}
+		err := descendantValues(reflect.ValueOf(rows), selection)
+		Expect(err).To(MatchError(ErrRangeIterations))
+		Expect(selection.nodes).To(HaveLen(10))
+	})
+})
@@ -0,0 +1,143 @@
+package endpoint
+
+import (
+	"context"
+
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+)
+
+// Option configures how a variable value is resolved. Options are needed because Variable is the protobuf
+// model and can't carry runtime settings.
+type Option func(*options)
+
+type options struct {
+	name        string
+	strict      bool
+	elementType pbEndpoint.VariableType
+	timeLayout  string
+	constraint  *Constraint
+	ctx         context.Context
+	limits      Limits
+	syntax      Syntax
+	err         error // invalid option, returned by GetValue
+
+	defaultValuePolicy *ValuePolicy
+	valuePolicies      map[string]ValuePolicy
+
+	stepVariables map[string]any // resolved variables of the step, visible as .Var
+	isView        bool           // the context data is already a view
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{ctx: context.Background(), limits: DefaultLimits}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Syntax is a syntax of variable values read only when it's enabled with WithSyntax, values are templates or
+// literals otherwise. A value such as "$.99" stays a literal for the endpoints that don't opt in.
+type Syntax uint8
+
+const (
+	// SyntaxPath reads the values starting with "$." or "$[" as path expressions, see path.go.
+	SyntaxPath Syntax = 1 << iota
+	// SyntaxExpression reads the values starting with a registered evaluator name and ":" as expressions,
+	// ex: "expr:Req.Query.age >= 18", see evaluator.go.
+	SyntaxExpression
+)
+
+// WithSyntax enables syntaxes of variable values besides templates and literals, ex:
+// WithSyntax(SyntaxPath|SyntaxExpression).
+func WithSyntax(syntax Syntax) Option {
+	return func(o *options) {
+		o.syntax |= syntax
+	}
+}
+
+// WithName sets the variable name reported in errors.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithStrict makes missing keys and template errors fail instead of resolving to an empty value. A missing
+// value still falls back to the default when the variable is required and has a default.
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithElementType sets the type of each element of a VariableTypeArray variable. Elements are kept as is when
+// it's not set.
+func WithElementType(elementType pbEndpoint.VariableType) Option {
+	return func(o *options) {
+		o.elementType = elementType
+	}
+}
+
+// WithTimeLayout sets the layout used to parse a VariableTypeDatetime variable, ex: "2006-01-02" or "RFC3339".
+func WithTimeLayout(layout string) Option {
+	return func(o *options) {
+		o.timeLayout = layout
+	}
+}
+
+// WithConstraint enforces the constraint on the resolved value. Violations are returned as *ValidationError.
+func WithConstraint(constraint Constraint) Option {
+	return func(o *options) {
+		o.constraint = &constraint
+	}
+}
+
+// withStepVariables overlays values on the step variables seen by the template as .Var.
+func withStepVariables(values map[string]any) Option {
+	return func(o *options) {
+		o.stepVariables = values
+	}
+}
+
+// withView tells the context data given to GetValue is already a view, ex: one view shared by every variable of
+// a step.
+func withView() Option {
+	return func(o *options) {
+		o.isView = true
+	}
+}
+
+// WithContext sets the context of the evaluation, it stops when the context is done. A nil context fails with
+// ErrNilContext.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		if ctx == nil {
+			o.err = ErrNilContext
+			return
+		}
+		o.ctx = ctx
+	}
+}
+
+// WithLimits bounds the evaluation, DefaultLimits is used without it and a zero Limits is unlimited.
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// WithValuePolicy sets which missing, null or zero values use the default, see DefaultValuePolicy.
+func WithValuePolicy(policy ValuePolicy) Option {
+	return func(o *options) {
+		o.defaultValuePolicy = &policy
+	}
+}
+
+// WithValuePolicies sets the policy per variable name, ex: for ResolveVariables. Variables without an entry use
+// WithValuePolicy or DefaultValuePolicy.
+func WithValuePolicies(policies map[string]ValuePolicy) Option {
+	return func(o *options) {
+		o.valuePolicies = policies
+	}
+}
@@ -0,0 +1,832 @@
+package endpoint
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Path expressions resolve a value directly from the context data and return the native value, without
+// rendering it through a template. The syntax is JSONPath-like and starts from the same root as templates:
+//
+//	$.Req.Json.json_2.json_2_a
+//	$.Step.<StepId>.Data.Query.query_1[0].col_a
+//	$.Step.<StepId>.Data.Query.query_1[*].col_a
+//	$.Step.<StepId>.Data.Query.query_1[?(@.col_b == 'val_b_2')].col_a
+//	$.Step.<StepId>.Data.Query.query_1[-1:]
+//	$..col_a
+//
+// A path without wildcard, slice, filter or recursive descent returns a single value, otherwise it returns
+// a []any with every match. Both return nil when nothing matches. Values are read as paths only with
+// WithSyntax(SyntaxPath).
+
+type pathSegmentKind int
+
+const (
+	pathSegmentChild pathSegmentKind = iota
+	pathSegmentIndex
+	pathSegmentWildcard
+	pathSegmentSlice
+	pathSegmentFilter
+	pathSegmentRecursive
+)
+
+type pathSegment struct {
+	kind   pathSegmentKind
+	name   string
+	index  int
+	start  *int
+	end    *int
+	filter pathFilter
+}
+
+type pathExpression struct {
+	raw      string
+	segments []pathSegment
+	definite bool
+}
+
+// isPathExpression tells whether a value is read as a path, the root alone is not a value.
+func isPathExpression(value string, syntax Syntax) bool {
+	value = strings.TrimSpace(value)
+	return syntax&SyntaxPath != 0 && (strings.HasPrefix(value, "$.") || strings.HasPrefix(value, "$["))
+}
+
+func compilePath(expression string) (*pathExpression, error) {
+	parser := &pathParser{input: strings.TrimSpace(expression)}
+
+	if !parser.consume('$') {
+		return nil, parser.errorf("path must start with '$'")
+	}
+
+	path, err := parser.parseSegments(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if !parser.eof() {
+		return nil, parser.errorf("unexpected character %q", parser.peek())
+	}
+
+	return path, nil
+}
+
+// evaluate resolves the path against root. found is false when nothing matches. The nodes selected by
+// wildcards, slices, filters and recursive descents count as iterations of the limits.
+func (p *pathExpression) evaluate(root any, state *executionState) (result any, found bool, err error) {
+	nodes, err := p.evaluateNodes(reflect.ValueOf(root), reflect.ValueOf(root), state)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if p.definite {
+		if len(nodes) == 0 {
+			return nil, false, nil
+		}
+		return valueInterface(nodes[0]), true, nil
+	}
+
+	if len(nodes) == 0 {
+		return nil, false, nil
+	}
+
+	results := make([]any, 0, len(nodes))
+	for _, node := range nodes {
+		results = append(results, valueInterface(node))
+	}
+
+	return results, true, nil
+}
+
+// evaluateNodes applies the segments from current, state is nil for the paths of filters.
+func (p *pathExpression) evaluateNodes(root, current reflect.Value, state *executionState) ([]reflect.Value, error) {
+	nodes := []reflect.Value{current}
+
+	for _, segment := range p.segments {
+		selection := &pathSelection{state: state, isIteration: segment.kind != pathSegmentChild && segment.kind != pathSegmentIndex}
+		for _, node := range nodes {
+			if err := segment.apply(root, node, selection); err != nil {
+				return nil, err
+			}
+		}
+
+		if state != nil {
+			if err := state.checkContext(); err != nil {
+				return nil, err
+			}
+		}
+
+		nodes = selection.nodes
+		if len(nodes) == 0 {
+			break
+		}
+	}
+
+	return nodes, nil
+}
+
+// pathSelection collects the nodes selected by a segment. The nodes of wildcards, slices, filters and recursive
+// descents are counted as they are selected, so the limits stop the selection before it's complete.
+type pathSelection struct {
+	nodes       []reflect.Value
+	state       *executionState
+	isIteration bool
+}
+
+func (s *pathSelection) add(node reflect.Value) error {
+	if s.state != nil && s.isIteration {
+		if err := s.state.iterate(1); err != nil {
+			return err
+		}
+	}
+
+	s.nodes = append(s.nodes, node)
+	return nil
+}
+
+func (s pathSegment) apply(root, node reflect.Value, selection *pathSelection) error {
+	node = indirectValue(node)
+	if !node.IsValid() {
+		return nil
+	}
+
+	switch s.kind {
+	case pathSegmentChild:
+		if child := childValue(node, s.name); child.IsValid() {
+			return selection.add(child)
+		}
+
+	case pathSegmentIndex:
+		if !isListValue(node) {
+			return nil
+		}
+
+		index := s.index
+		if index < 0 {
+			index += node.Len()
+		}
+		if index >= 0 && index < node.Len() {
+			return selection.add(node.Index(index))
+		}
+
+	case pathSegmentWildcard:
+		for _, child := range childValues(node) {
+			if err := selection.add(child); err != nil {
+				return err
+			}
+		}
+
+	case pathSegmentSlice:
+		if !isListValue(node) {
+			return nil
+		}
+
+		start, end := sliceBounds(s.start, s.end, node.Len())
+		for i := start; i < end; i++ {
+			if err := selection.add(node.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case pathSegmentFilter:
+		for _, child := range childValues(node) {
+			if !s.filter.match(root, child) {
+				continue
+			}
+			if err := selection.add(child); err != nil {
+				return err
+			}
+		}
+
+	case pathSegmentRecursive:
+		return descendantValues(node, selection)
+	}
+
+	return nil
+}
+
+func sliceBounds(startPtr, endPtr *int, length int) (int, int) {
+	start, end := 0, length
+
+	if startPtr != nil {
+		start = *startPtr
+		if start < 0 {
+			start += length
+		}
+	}
+	if endPtr != nil {
+		end = *endPtr
+		if end < 0 {
+			end += length
+		}
+	}
+
+	start = max(0, min(start, length))
+	end = max(0, min(end, length))
+	if start > end {
+		return 0, 0
+	}
+
+	return start, end
+}
+
+// indirectValue unwraps interfaces and pointers, returning an invalid value for nil.
+func indirectValue(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+
+	return value
+}
+
+func valueInterface(value reflect.Value) any {
+	value = indirectValue(value)
+	if !value.IsValid() || !value.CanInterface() {
+		return nil
+	}
+
+	return value.Interface()
+}
+
+func isListValue(value reflect.Value) bool {
+	return value.Kind() == reflect.Slice || value.Kind() == reflect.Array
+}
+
+func childValue(node reflect.Value, name string) reflect.Value {
+	switch node.Kind() {
+	case reflect.Struct:
+		field, ok := node.Type().FieldByName(name)
+		if !ok || !field.IsExported() {
+			return reflect.Value{}
+		}
+		return node.FieldByIndex(field.Index)
+
+	case reflect.Map:
+		if node.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}
+		}
+		return node.MapIndex(reflect.ValueOf(name).Convert(node.Type().Key()))
+	}
+
+	return reflect.Value{}
+}
+
+// childValues returns the direct children of node. Map children are sorted by key so results are stable.
+func childValues(node reflect.Value) []reflect.Value {
+	var result []reflect.Value
+
+	switch node.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < node.Len(); i++ {
+			result = append(result, node.Index(i))
+		}
+
+	case reflect.Map:
+		keys := node.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			result = append(result, node.MapIndex(key))
+		}
+
+	case reflect.Struct:
+		for i := 0; i < node.NumField(); i++ {
+			if node.Type().Field(i).IsExported() {
+				result = append(result, node.Field(i))
+			}
+		}
+	}
+
+	return result
+}
+
+// descendantValues selects node and all of its descendants in depth-first order.
+func descendantValues(node reflect.Value, selection *pathSelection) error {
+	if err := selection.add(node); err != nil {
+		return err
+	}
+
+	for _, child := range childValues(node) {
+		if child = indirectValue(child); child.IsValid() {
+			if err := descendantValues(child, selection); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// pathFilter is a boolean expression used in [?(...)] segments.
+type pathFilter interface {
+	match(root, current reflect.Value) bool
+}
+
+type pathFilterLogical struct {
+	operator string // && or ||
+	left     pathFilter
+	right    pathFilter
+}
+
+func (f pathFilterLogical) match(root, current reflect.Value) bool {
+	if f.operator == "&&" {
+		return f.left.match(root, current) && f.right.match(root, current)
+	}
+	return f.left.match(root, current) || f.right.match(root, current)
+}
+
+type pathFilterNot struct {
+	filter pathFilter
+}
+
+func (f pathFilterNot) match(root, current reflect.Value) bool {
+	return !f.filter.match(root, current)
+}
+
+type pathFilterComparison struct {
+	operator string // empty means existence check of left
+	left     pathOperand
+	right    pathOperand
+}
+
+func (f pathFilterComparison) match(root, current reflect.Value) bool {
+	left, leftFound := f.left.resolve(root, current)
+
+	if f.operator == "" {
+		if !leftFound || left == nil {
+			return false
+		}
+		if boolValue, ok := left.(bool); ok {
+			return boolValue
+		}
+		return true
+	}
+
+	right, _ := f.right.resolve(root, current)
+
+	switch f.operator {
+	case "==":
+		return compareEqual(left, right)
+	case "!=":
+		return !compareEqual(left, right)
+	}
+
+	compared, ok := compareOrdered(left, right)
+	if !ok {
+		return false
+	}
+
+	switch f.operator {
+	case "<":
+		return compared < 0
+	case "<=":
+		return compared <= 0
+	case ">":
+		return compared > 0
+	case ">=":
+		return compared >= 0
+	}
+
+	return false
+}
+
+type pathOperand struct {
+	path    *pathExpression
+	isRoot  bool
+	literal any
+}
+
+func (o pathOperand) resolve(root, current reflect.Value) (any, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+
+	start := current
+	if o.isRoot {
+		start = root
+	}
+
+	nodes, _ := o.path.evaluateNodes(root, start, nil)
+	if len(nodes) == 0 {
+		return nil, false
+	}
+
+	return valueInterface(nodes[0]), true
+}
+
+func isNumber(value any) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+func compareEqual(left, right any) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return cast.ToFloat64(left) == cast.ToFloat64(right)
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func compareOrdered(left, right any) (int, bool) {
+	if isNumber(left) && isNumber(right) {
+		leftNumber, rightNumber := cast.ToFloat64(left), cast.ToFloat64(right)
+		switch {
+		case leftNumber < rightNumber:
+			return -1, true
+		case leftNumber > rightNumber:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	leftString, leftOk := left.(string)
+	rightString, rightOk := right.(string)
+	if leftOk && rightOk {
+		return strings.Compare(leftString, rightString), true
+	}
+
+	return 0, false
+}
+
+type pathParser struct {
+	input string
+	pos   int
+}
+
+func (p *pathParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *pathParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *pathParser) consume(c byte) bool {
+	if p.peek() == c && !p.eof() {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) consumeString(s string) bool {
+	if strings.HasPrefix(p.input[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *pathParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid path expression %q at position %d: %s", p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+// parseSegments parses segments until a character that can't continue a path.
+func (p *pathParser) parseSegments(raw string) (*pathExpression, error) {
+	path := &pathExpression{raw: raw, definite: true}
+
+	for !p.eof() {
+		switch {
+		case p.consumeString(".."):
+			path.segments = append(path.segments, pathSegment{kind: pathSegmentRecursive})
+			path.definite = false
+
+			if p.peek() == '[' {
+				continue
+			}
+			if err := p.parseDotSegment(path); err != nil {
+				return nil, err
+			}
+
+		case p.consume('.'):
+			if err := p.parseDotSegment(path); err != nil {
+				return nil, err
+			}
+
+		case p.consume('['):
+			if err := p.parseBracketSegment(path); err != nil {
+				return nil, err
+			}
+
+		default:
+			return path, nil
+		}
+	}
+
+	return path, nil
+}
+
+func (p *pathParser) parseDotSegment(path *pathExpression) error {
+	if p.consume('*') {
+		path.segments = append(path.segments, pathSegment{kind: pathSegmentWildcard})
+		path.definite = false
+		return nil
+	}
+
+	name := p.parseIdentifier()
+	if name == "" {
+		return p.errorf("expected property name")
+	}
+
+	path.segments = append(path.segments, pathSegment{kind: pathSegmentChild, name: name})
+	return nil
+}
+
+func (p *pathParser) parseIdentifier() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *pathParser) parseBracketSegment(path *pathExpression) error {
+	p.skipSpaces()
+
+	switch {
+	case p.consume('*'):
+		path.segments = append(path.segments, pathSegment{kind: pathSegmentWildcard})
+		path.definite = false
+
+	case p.peek() == '\'' || p.peek() == '"':
+		name, err := p.parseQuoted()
+		if err != nil {
+			return err
+		}
+		path.segments = append(path.segments, pathSegment{kind: pathSegmentChild, name: name})
+
+	case p.consume('?'):
+		p.skipSpaces()
+		if !p.consume('(') {
+			return p.errorf("expected '(' after '?'")
+		}
+
+		filter, err := p.parseFilterOr()
+		if err != nil {
+			return err
+		}
+
+		p.skipSpaces()
+		if !p.consume(')') {
+			return p.errorf("expected ')' to close filter")
+		}
+
+		path.segments = append(path.segments, pathSegment{kind: pathSegmentFilter, filter: filter})
+		path.definite = false
+
+	default:
+		segment, err := p.parseIndexOrSlice()
+		if err != nil {
+			return err
+		}
+		if segment.kind == pathSegmentSlice {
+			path.definite = false
+		}
+		path.segments = append(path.segments, segment)
+	}
+
+	p.skipSpaces()
+	if !p.consume(']') {
+		return p.errorf("expected ']'")
+	}
+
+	return nil
+}
+
+func (p *pathParser) parseIndexOrSlice() (pathSegment, error) {
+	start, hasStart, err := p.parseInt()
+	if err != nil {
+		return pathSegment{}, err
+	}
+
+	p.skipSpaces()
+	if !p.consume(':') {
+		if !hasStart {
+			return pathSegment{}, p.errorf("expected index, slice, wildcard, filter or quoted name")
+		}
+		return pathSegment{kind: pathSegmentIndex, index: start}, nil
+	}
+
+	p.skipSpaces()
+	end, hasEnd, err := p.parseInt()
+	if err != nil {
+		return pathSegment{}, err
+	}
+
+	segment := pathSegment{kind: pathSegmentSlice}
+	if hasStart {
+		segment.start = &start
+	}
+	if hasEnd {
+		segment.end = &end
+	}
+
+	return segment, nil
+}
+
+func (p *pathParser) parseInt() (int, bool, error) {
+	start := p.pos
+	p.consume('-')
+	for !p.eof() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return 0, false, nil
+	}
+
+	value, err := strconv.Atoi(p.input[start:p.pos])
+	if err != nil {
+		return 0, false, p.errorf("invalid index %q", p.input[start:p.pos])
+	}
+
+	return value, true, nil
+}
+
+func (p *pathParser) parseQuoted() (string, error) {
+	quote := p.peek()
+	p.pos++
+
+	var builder strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+
+		switch c {
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			builder.WriteByte(p.peek())
+			p.pos++
+		case quote:
+			return builder.String(), nil
+		default:
+			builder.WriteByte(c)
+		}
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+func (p *pathParser) parseFilterOr() (pathFilter, error) {
+	left, err := p.parseFilterAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipSpaces()
+		if !p.consumeString("||") {
+			return left, nil
+		}
+
+		right, err := p.parseFilterAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = pathFilterLogical{operator: "||", left: left, right: right}
+	}
+}
+
+func (p *pathParser) parseFilterAnd() (pathFilter, error) {
+	left, err := p.parseFilterUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipSpaces()
+		if !p.consumeString("&&") {
+			return left, nil
+		}
+
+		right, err := p.parseFilterUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = pathFilterLogical{operator: "&&", left: left, right: right}
+	}
+}
+
+func (p *pathParser) parseFilterUnary() (pathFilter, error) {
+	p.skipSpaces()
+
+	if p.peek() == '!' && !strings.HasPrefix(p.input[p.pos:], "!=") {
+		p.pos++
+		filter, err := p.parseFilterUnary()
+		if err != nil {
+			return nil, err
+		}
+		return pathFilterNot{filter: filter}, nil
+	}
+
+	if p.consume('(') {
+		filter, err := p.parseFilterOr()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpaces()
+		if !p.consume(')') {
+			return nil, p.errorf("expected ')'")
+		}
+		return filter, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consumeString(operator) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return pathFilterComparison{operator: operator, left: left, right: right}, nil
+		}
+	}
+
+	if left.path == nil {
+		return nil, p.errorf("expected comparison operator")
+	}
+
+	return pathFilterComparison{left: left}, nil
+}
+
+func (p *pathParser) parseOperand() (pathOperand, error) {
+	p.skipSpaces()
+
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		path, err := p.parseSegments(p.input)
+		if err != nil {
+			return pathOperand{}, err
+		}
+		return pathOperand{path: path, isRoot: c == '$'}, nil
+
+	case c == '\'' || c == '"':
+		value, err := p.parseQuoted()
+		if err != nil {
+			return pathOperand{}, err
+		}
+		return pathOperand{literal: value}, nil
+
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for !p.eof() && (p.peek() >= '0' && p.peek() <= '9' || p.peek() == '.' || p.peek() == 'e' || p.peek() == 'E') {
+			p.pos++
+		}
+
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return pathOperand{}, p.errorf("invalid number %q", p.input[start:p.pos])
+		}
+		return pathOperand{literal: value}, nil
+	}
+
+	switch {
+	case p.consumeString("true"):
+		return pathOperand{literal: true}, nil
+	case p.consumeString("false"):
+		return pathOperand{literal: false}, nil
+	case p.consumeString("null"):
+		return pathOperand{literal: nil}, nil
+	}
+
+	return pathOperand{}, p.errorf("expected operand")
+}
@@ -0,0 +1,158 @@
+package endpoint
+
+import (
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path Expression", func() {
+	mockStepId := "mockStepId"
+
+	mockCtxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Query: map[string]any{
+				"age": 21,
+			},
+			Json: map[string]any{
+				"json_2": map[string]any{
+					"json_2_a": 123,
+				},
+			},
+		},
+		Step: map[string]entityContext.ContextStepData{
+			mockStepId: {
+				Var: map[string]any{
+					"var_1": "value_var_1",
+				},
+			},
+			"mysql": {
+				Data: entityContext.ContextStepDataBody{
+					Query: map[string]any{
+						"query_1": []any{
+							map[string]any{"col_a": "val_a_1", "col_b": 10},
+							map[string]any{"col_a": "val_a_2", "col_b": 20},
+							map[string]any{"col_a": "val_a_3", "col_b": 30},
+						},
+					},
+					StatusCode: 200,
+				},
+			},
+		},
+	}
+
+	runTest := func(value string, varType pbEndpoint.VariableType, wantResult any, wantErr bool) {
+		variable := &Variable{Value: value, Type: varType}
+		got, err := variable.GetValue(mockStepId, mockCtxData, WithSyntax(SyntaxPath))
+
+		if wantResult == nil {
+			Expect(got).To(BeNil())
+		} else {
+			Expect(got).To(Equal(wantResult))
+		}
+
+		if wantErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).To(BeNil())
+		}
+	}
+
+	Context("Child", func() {
+		It("$.Req.Json.<Key> - object keeps native type", func() {
+			runTest("$.Req.Json.json_2", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, map[string]any{"json_2_a": 123}, false)
+		})
+		It("$.Req.Json.<Key>.<Key> - nested", func() {
+			runTest("$.Req.Json.json_2.json_2_a", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(123), false)
+		})
+		It("$.Req.Json['<Key>'] - bracket notation", func() {
+			runTest("$.Req.Json['json_2'][\"json_2_a\"]", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(123), false)
+		})
+		It("$.Var.<Key> - current step", func() {
+			runTest("$.Var.var_1", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "value_var_1", false)
+		})
+		It("$.Step.<StepId>.Data.StatusCode - struct field", func() {
+			runTest("$.Step.mysql.Data.StatusCode", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(200), false)
+		})
+		It("$.Req.Json.<Key> - not exist", func() {
+			runTest("$.Req.Json.unknown.unknown", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, nil, false)
+		})
+		It("$.Step.<StepId> - unexported or unknown field", func() {
+			runTest("$.Step.mysql.Data.unknown", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, nil, false)
+		})
+	})
+
+	Context("Index", func() {
+		It("[0] - first row", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[0].col_a", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "val_a_1", false)
+		})
+		It("[-1] - last row", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[-1].col_a", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "val_a_3", false)
+		})
+		It("[10] - index > length", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[10].col_a", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, nil, false)
+		})
+		It("[1:] - slice", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[1:].col_a", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{"val_a_2", "val_a_3"}, false)
+		})
+	})
+
+	Context("Wildcard", func() {
+		It("[*] - every row", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[*].col_b", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{10, 20, 30}, false)
+		})
+		It("..<Key> - recursive descent", func() {
+			runTest("$.Step.mysql..col_a", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{"val_a_1", "val_a_2", "val_a_3"}, false)
+		})
+		It("[*] - no match", func() {
+			runTest("$.Req.Json.unknown[*]", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, nil, false)
+		})
+	})
+
+	Context("Filter", func() {
+		It("== string", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[?(@.col_a == 'val_a_2')].col_b", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{20}, false)
+		})
+		It(">= number && != string", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[?(@.col_b >= 20 && @.col_a != 'val_a_3')].col_a", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{"val_a_2"}, false)
+		})
+		It("compare with root path", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[?(@.col_b > $.Req.Query.age)].col_a", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{"val_a_3"}, false)
+		})
+		It("existence and negation", func() {
+			runTest("$.Step.mysql.Data.Query.query_1[?(!@.unknown)].col_b", pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT, []any{10, 20, 30}, false)
+		})
+	})
+
+	Context("Invalid", func() {
+		It("unterminated bracket", func() {
+			runTest("$.Req.Json[0", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, nil, true)
+		})
+		It("invalid filter", func() {
+			runTest("$.Req.Json[?(@.a ==)]", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, nil, true)
+		})
+		It("$ - the root is not a path", func() {
+			runTest("$", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "$", false)
+		})
+		It("$.Req - the error doesn't format the value", func() {
+			_, err := (&Variable{Value: "$.Req", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}).
+				GetValue(mockStepId, mockCtxData, WithSyntax(SyntaxPath))
+			Expect(err).To(MatchError(ContainSubstring("unable to cast a value of type context.ContextRequestData to string")))
+			Expect(err.Error()).NotTo(ContainSubstring("json_2_a"))
+		})
+	})
+
+	Context("Syntax not enabled", func() {
+		It("$.<Key> - literal", func() {
+			got, err := (&Variable{Value: "$.99", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}).GetValue(mockStepId, mockCtxData)
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal("$.99"))
+		})
+		It("$ - literal", func() {
+			got, err := (&Variable{Value: "$", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}).GetValue(mockStepId, mockCtxData)
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal("$"))
+		})
+	})
+})
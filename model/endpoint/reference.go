@@ -0,0 +1,260 @@
+package endpoint
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// variableReferences returns every context path referenced by a variable value, ex: "Req.Query.x",
+// "Step.<StepId>.Data.Body" or "Var.y". Literal values have no reference, syntax is the one enabled with
+// WithSyntax.
+func variableReferences(value string, syntax Syntax) ([]string, error) {
+	references := make(map[string]struct{})
+
+	evaluator, expression, isExpression := lookupEvaluator(value, syntax)
+
+	switch {
+	case isExpression:
+		// an evaluator that can't list its references is not analyzed
+		if referenceEvaluator, ok := evaluator.(IReferenceEvaluator); ok {
+			expressionReferences, err := referenceEvaluator.References(expression)
+			if err != nil {
+				return nil, err
+			}
+			for _, reference := range expressionReferences {
+				references[reference] = struct{}{}
+			}
+		}
+
+	case isPathExpression(value, syntax):
+		path, err := pathCache.getOrCompile(value, compilePath)
+		if err != nil {
+			return nil, err
+		}
+		collectPathReferences(path, references)
+
+	case strings.Contains(value, "{{"):
+		tmpl, err := getCompiledTemplate(value, false)
+		if err != nil {
+			return nil, err
+		}
+		collectTemplateReferences(tmpl.tmpl, references)
+	}
+
+	result := make([]string, 0, len(references))
+	for reference := range references {
+		result = append(result, reference)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// collectPathReferences adds the leading property names of a path and every root path used in its filters.
+func collectPathReferences(path *pathExpression, references map[string]struct{}) {
+	var (
+		names     []string
+		isLeading = true
+	)
+
+	for _, segment := range path.segments {
+		if isLeading && segment.kind == pathSegmentChild {
+			names = append(names, segment.name)
+			continue
+		}
+
+		isLeading = false
+		if segment.kind == pathSegmentFilter {
+			collectFilterReferences(segment.filter, references)
+		}
+	}
+
+	if len(names) > 0 {
+		references[strings.Join(names, ".")] = struct{}{}
+	}
+}
+
+func collectFilterReferences(filter pathFilter, references map[string]struct{}) {
+	switch f := filter.(type) {
+	case pathFilterLogical:
+		collectFilterReferences(f.left, references)
+		collectFilterReferences(f.right, references)
+	case pathFilterNot:
+		collectFilterReferences(f.filter, references)
+	case pathFilterComparison:
+		for _, operand := range []pathOperand{f.left, f.right} {
+			if operand.path != nil && operand.isRoot {
+				collectPathReferences(operand.path, references)
+			}
+		}
+	}
+}
+
+// templateReferences walks the trees of a template, following the defined templates it calls.
+type templateReferences struct {
+	tmpl       *template.Template
+	references map[string]struct{}
+	visited    map[templateCall]bool
+}
+
+// templateCall is a defined template walked with a given root, a template can call itself.
+type templateCall struct {
+	name   string
+	isRoot bool
+}
+
+// collectTemplateReferences adds the references of the template and of the defined templates it calls.
+func collectTemplateReferences(tmpl *template.Template, references map[string]struct{}) {
+	collector := &templateReferences{tmpl: tmpl, references: references, visited: make(map[templateCall]bool)}
+	collector.collect(tmpl.Tree.Root, true, true)
+}
+
+// collect walks a template tree. isRootDot tells whether "." is still the template data, it changes inside
+// range and with blocks. isRootDollar tells whether "$" is the template data, it's the argument of a defined
+// template.
+func (c *templateReferences) collect(node parse.Node, isRootDot, isRootDollar bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.collect(child, isRootDot, isRootDollar)
+		}
+
+	case *parse.ActionNode:
+		c.collect(n.Pipe, isRootDot, isRootDollar)
+
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			c.collect(cmd, isRootDot, isRootDollar)
+		}
+
+	case *parse.CommandNode:
+		args := n.Args
+		if reference, _, ok := c.indexReference(n, isRootDot, isRootDollar); ok {
+			c.references[reference] = struct{}{}
+			args = args[2:]
+		}
+		for _, arg := range args {
+			c.collect(arg, isRootDot, isRootDollar)
+		}
+
+	case *parse.IfNode:
+		c.collect(n.Pipe, isRootDot, isRootDollar)
+		c.collect(n.List, isRootDot, isRootDollar)
+		c.collect(n.ElseList, isRootDot, isRootDollar)
+
+	case *parse.RangeNode:
+		c.collect(n.Pipe, isRootDot, isRootDollar)
+		c.collect(n.List, false, isRootDollar)
+		c.collect(n.ElseList, isRootDot, isRootDollar)
+
+	case *parse.WithNode:
+		c.collect(n.Pipe, isRootDot, isRootDollar)
+		c.collect(n.List, false, isRootDollar)
+		c.collect(n.ElseList, isRootDot, isRootDollar)
+
+	case *parse.TemplateNode:
+		c.collect(n.Pipe, isRootDot, isRootDollar)
+		c.collectDefinedTemplate(n, isRootDot, isRootDollar)
+
+	case *parse.ChainNode:
+		// (index .Step "id").Data.Body
+		if pipe, ok := n.Node.(*parse.PipeNode); ok && len(pipe.Cmds) == 1 {
+			if reference, isComplete, ok := c.indexReference(pipe.Cmds[0], isRootDot, isRootDollar); ok {
+				if isComplete {
+					reference = strings.Join(append([]string{reference}, n.Field...), ".")
+				}
+				c.references[reference] = struct{}{}
+				for _, arg := range pipe.Cmds[0].Args[2:] {
+					c.collect(arg, isRootDot, isRootDollar)
+				}
+				return
+			}
+		}
+		c.collect(n.Node, isRootDot, isRootDollar)
+
+	case *parse.FieldNode:
+		if isRootDot {
+			c.references[strings.Join(n.Ident, ".")] = struct{}{}
+		}
+
+	case *parse.VariableNode:
+		if isRootDollar && len(n.Ident) > 1 && n.Ident[0] == "$" {
+			c.references[strings.Join(n.Ident[1:], ".")] = struct{}{}
+		}
+	}
+}
+
+// indexReference returns the reference of an index command on the template data with string keys, ex:
+// {{index .Step "step-1" "Data"}} references Step.step-1.Data. The keys following the first non string one
+// are not part of the reference, isComplete is false then.
+func (c *templateReferences) indexReference(cmd *parse.CommandNode, isRootDot, isRootDollar bool) (reference string, isComplete, ok bool) {
+	if len(cmd.Args) < 2 {
+		return "", false, false
+	}
+	if identifier, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || identifier.Ident != "index" {
+		return "", false, false
+	}
+
+	var names []string
+	switch base := cmd.Args[1].(type) {
+	case *parse.FieldNode:
+		if !isRootDot {
+			return "", false, false
+		}
+		names = append(names, base.Ident...)
+	case *parse.VariableNode:
+		if !isRootDollar || len(base.Ident) < 2 || base.Ident[0] != "$" {
+			return "", false, false
+		}
+		names = append(names, base.Ident[1:]...)
+	default:
+		return "", false, false
+	}
+
+	isComplete = true
+	for _, arg := range cmd.Args[2:] {
+		key, ok := arg.(*parse.StringNode)
+		if !ok {
+			isComplete = false
+			break
+		}
+		names = append(names, key.Text)
+	}
+
+	return strings.Join(names, "."), isComplete, true
+}
+
+// collectDefinedTemplate walks the template called by a {{template}} action, its "." and "$" are the template
+// data when it's called with "." or "$".
+func (c *templateReferences) collectDefinedTemplate(node *parse.TemplateNode, isRootDot, isRootDollar bool) {
+	defined := c.tmpl.Lookup(node.Name)
+	if defined == nil || defined.Tree == nil {
+		return
+	}
+
+	isRoot := false
+	if node.Pipe != nil && len(node.Pipe.Decl) == 0 && len(node.Pipe.Cmds) == 1 && len(node.Pipe.Cmds[0].Args) == 1 {
+		switch arg := node.Pipe.Cmds[0].Args[0].(type) {
+		case *parse.DotNode:
+			isRoot = isRootDot
+		case *parse.VariableNode:
+			isRoot = isRootDollar && len(arg.Ident) == 1 && arg.Ident[0] == "$"
+		}
+	}
+
+	call := templateCall{name: node.Name, isRoot: isRoot}
+	if c.visited[call] {
+		return
+	}
+	c.visited[call] = true
+
+	c.collect(defined.Tree.Root, isRoot, isRoot)
+}
@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+)
+
+// ErrVariableCycle is returned when variables of a step depend on each other in a cycle.
+var ErrVariableCycle = errors.New("variable dependency cycle")
+
+// ResolveVariables resolves every variable of a step into a map ready for ContextData.SetStepVariable.
+// A variable can use another variable of the same step with {{.Var.<Name>}} or $.Var.<Name>, variables are
+// resolved in dependency order. A nil variable is skipped, it has no value.
+func ResolveVariables(stepId string, ctxData *entityContext.ContextData, variables map[string]*Variable, opts ...Option) (map[string]any, error) {
+	order, err := SortVariables(variables, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		values = make(map[string]any, len(variables))
+		view   = ctxData.View()
+	)
+	for _, name := range order {
+		variable := variables[name]
+		if variable == nil {
+			continue
+		}
+
+		variableOpts := append(append([]Option{}, opts...), WithName(name), withStepVariables(values), withView())
+
+		value, err := variable.GetValue(stepId, view, variableOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// SortVariables returns the variable names ordered so every variable comes after the variables it
+// references. Independent variables are sorted by name. The options enabling syntaxes are the ones given to
+// GetValue.
+func SortVariables(variables map[string]*Variable, opts ...Option) ([]string, error) {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		syntax = newOptions(opts).syntax
+		state  = make(map[string]int, len(variables))
+		order  = make([]string, 0, len(variables))
+		stack  []string
+		visit  func(name string) error
+	)
+
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			cycleStart := 0
+			for i, stackName := range stack {
+				if stackName == name {
+					cycleStart = i
+				}
+			}
+			cycle := append(append([]string{}, stack[cycleStart:]...), name)
+			return fmt.Errorf("%w: %s", ErrVariableCycle, strings.Join(cycle, " -> "))
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, dependency := range variableDependencies(variables[name], variables, syntax) {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// variableDependencies returns the names of the other variables of the step referenced by variable.
+func variableDependencies(variable *Variable, variables map[string]*Variable, syntax Syntax) []string {
+	if variable == nil {
+		return nil
+	}
+
+	// invalid values are reported when the variable is resolved
+	references, _ := variableReferences(variable.Value, syntax)
+
+	var dependencies []string
+	for _, reference := range references {
+		parts := strings.Split(reference, ".")
+		if len(parts) < 2 || parts[0] != "Var" {
+			continue
+		}
+
+		if _, ok := variables[parts[1]]; ok && !containsString(dependencies, parts[1]) {
+			dependencies = append(dependencies, parts[1])
+		}
+	}
+
+	return dependencies
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
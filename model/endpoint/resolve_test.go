@@ -0,0 +1,168 @@
+package endpoint
+
+import (
+	"sync"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolve Variables", func() {
+	mockStepId := "mockStepId"
+
+	newCtxData := func() *entityContext.ContextData {
+		return &entityContext.ContextData{
+			Req: entityContext.ContextRequestData{
+				Query: map[string]any{
+					"first_name": "John",
+					"last_name":  "Doe",
+					"age":        17,
+				},
+			},
+			Step: map[string]entityContext.ContextStepData{
+				mockStepId: {
+					Var: map[string]any{
+						"previous": "value_previous",
+					},
+				},
+			},
+		}
+	}
+
+	It("resolves variables in dependency order", func() {
+		ctxData := newCtxData()
+		variables := map[string]*Variable{
+			"greeting": {
+				Value: "Hello {{.Var.full_name}}, next year you are {{.Var.next_age}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			},
+			"full_name": {
+				Value: "{{.Var.first_name}} {{.Req.Query.last_name}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			},
+			"first_name": {
+				Value: "$.Req.Query.first_name",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			},
+			"next_age": {
+				Value: "{{add .Req.Query.age 1}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_INT,
+			},
+			"from_context": {
+				Value: "{{.Var.previous}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			},
+		}
+
+		order, err := SortVariables(variables, WithSyntax(SyntaxPath|SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(order).To(Equal([]string{"first_name", "from_context", "full_name", "next_age", "greeting"}))
+
+		values, err := ResolveVariables(mockStepId, ctxData, variables, WithSyntax(SyntaxPath|SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(values).To(Equal(map[string]any{
+			"greeting":     "Hello John Doe, next year you are 18",
+			"full_name":    "John Doe",
+			"first_name":   "John",
+			"next_age":     int64(18),
+			"from_context": "value_previous",
+		}))
+
+		ctxData.SetStepVariable(mockStepId, values)
+		Expect(ctxData.Step[mockStepId].Var["greeting"]).To(Equal("Hello John Doe, next year you are 18"))
+	})
+
+	It("resolves while other steps write into the context", func() {
+		var (
+			ctxData   = newCtxData()
+			variables = map[string]*Variable{
+				"full_name": {Value: "{{.Req.Query.first_name}} {{.Req.Query.last_name}}"},
+				"other":     {Value: "$.Step.other.Data.Body.rows"},
+				"status":    {Value: "expr:Step.other.Data.StatusCode"},
+			}
+			wg sync.WaitGroup
+		)
+
+		wg.Add(2)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				ctxData.SetStepStatusCode("other", i)
+				ctxData.SetStepDataBody("other", map[string]any{"rows": []any{i}})
+			}
+		}()
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				values, err := ResolveVariables(mockStepId, ctxData, variables, WithSyntax(SyntaxPath|SyntaxExpression))
+				Expect(err).To(BeNil())
+				Expect(values["full_name"]).To(Equal("John Doe"))
+			}
+		}()
+		wg.Wait()
+	})
+
+	It("reports a cycle", func() {
+		_, err := ResolveVariables(mockStepId, newCtxData(), map[string]*Variable{
+			"a": {Value: "{{.Var.b}}"},
+			"b": {Value: "$.Var.c"},
+			"c": {Value: "{{if .Var.a}}x{{end}}"},
+			"d": {Value: "{{.Var.a}}"},
+		}, WithSyntax(SyntaxPath|SyntaxExpression))
+		Expect(err).To(MatchError(ErrVariableCycle))
+		Expect(err.Error()).To(ContainSubstring("a -> b -> c -> a"))
+	})
+
+	It("reports a self reference", func() {
+		_, err := SortVariables(map[string]*Variable{
+			"a": {Value: "{{.Var.a}}"},
+		})
+		Expect(err).To(MatchError(ErrVariableCycle))
+	})
+
+	It("skips a nil variable", func() {
+		values, err := ResolveVariables(mockStepId, newCtxData(), map[string]*Variable{
+			"first_name": {Value: "$.Req.Query.first_name"},
+			"missing":    nil,
+		}, WithSyntax(SyntaxPath))
+		Expect(err).To(BeNil())
+		Expect(values).To(Equal(map[string]any{"first_name": "John"}))
+	})
+
+	It("returns the error of a variable with its name", func() {
+		_, err := ResolveVariables(mockStepId, newCtxData(), map[string]*Variable{
+			"age": {Value: "{{.Req.Query.first_name}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT},
+		})
+
+		var variableErr *VariableError
+		Expect(err).To(BeAssignableToTypeOf(variableErr))
+		Expect(err.(*VariableError).Name).To(Equal("age"))
+	})
+
+	DescribeTable("variableReferences", func(value string, want []string) {
+		got, err := variableReferences(value, SyntaxPath)
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(want))
+	},
+		Entry("literal", "plain value", []string{}),
+		Entry("template fields", "{{.Req.Query.x}}-{{(index .Step.mysql.Data.Query.q 0).col}}", []string{"Req.Query.x", "Step.mysql.Data.Query.q"}),
+		Entry("template pipeline and if", "{{if .Var.a}}{{.Var.b | upper}}{{else}}{{$.Data.Body}}{{end}}", []string{"Data.Body", "Var.a", "Var.b"}),
+		Entry("template range skips relative fields", "{{range .Step.s.Out.rows}}{{.name}}{{$.Var.c}}{{end}}", []string{"Step.s.Out.rows", "Var.c"}),
+		Entry("template index with string keys", `{{index .Step "step-1" "Out" "id"}}-{{(index $.Step "step-2").Data.Body}}`, []string{"Step.step-1.Out.id", "Step.step-2.Data.Body"}),
+		Entry("template index with a dynamic key", `{{index .Step .Var.step "Out"}}`, []string{"Step", "Var.step"}),
+		Entry("template call with the root", `{{define "user"}}{{.Req.Query.id}}{{$.Var.a}}{{end}}{{template "user" .}}`, []string{"Req.Query.id", "Var.a"}),
+		Entry("template call with a field", `{{define "row"}}{{.name}}{{$.Var.a}}{{end}}{{template "row" .Step.s.Out}}`, []string{"Step.s.Out"}),
+		Entry("path", "$.Step.rest.Data.Body.items[*].id", []string{"Step.rest.Data.Body.items"}),
+		Entry("path filter with root", "$.Var.rows[?(@.id == $.Req.Query.id)]", []string{"Req.Query.id", "Var.rows"}),
+	)
+
+	It("variableReferences - path syntax not enabled", func() {
+		got, err := variableReferences("$.Var.rows", 0)
+		Expect(err).To(BeNil())
+		Expect(got).To(BeEmpty())
+	})
+})
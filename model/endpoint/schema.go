@@ -0,0 +1,185 @@
+package endpoint
+
+import (
+	"sort"
+
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+)
+
+// JSONSchema is the subset of JSON Schema (draft 2020-12, also valid as an OpenAPI 3.1 schema object)
+// generated from variables.
+type JSONSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Format     string                 `json:"format,omitempty"`
+	Default    any                    `json:"default,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Maximum    *float64               `json:"maximum,omitempty"`
+	MinLength  *int                   `json:"minLength,omitempty"`
+	MaxLength  *int                   `json:"maxLength,omitempty"`
+	MinItems   *int                   `json:"minItems,omitempty"`
+	MaxItems   *int                   `json:"maxItems,omitempty"`
+	Pattern    string                 `json:"pattern,omitempty"`
+	Enum       []any                  `json:"enum,omitempty"`
+	Items      *JSONSchema            `json:"items,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+}
+
+// OpenAPI parameter locations.
+const (
+	ParameterInQuery  = "query"
+	ParameterInHeader = "header"
+	ParameterInPath   = "path"
+	ParameterInCookie = "cookie"
+)
+
+// OpenAPIParameter is an OpenAPI 3 parameter object.
+type OpenAPIParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+// OpenAPIRequestBody is an OpenAPI 3 request body object.
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIMediaType is an OpenAPI 3 media type object.
+type OpenAPIMediaType struct {
+	Schema *JSONSchema `json:"schema"`
+}
+
+// GenerateJSONSchema returns the object schema of a set of variables, ex: the fields of a JSON request body.
+// A variable is required in the schema when it's required without a default, or when its constraint is
+// required; constraints are optional and keyed by variable name.
+func GenerateJSONSchema(variables map[string]*Variable, constraints map[string]Constraint) *JSONSchema {
+	schema := &JSONSchema{
+		Type:       "object",
+		Properties: make(map[string]*JSONSchema, len(variables)),
+	}
+
+	for _, name := range sortedVariableNames(variables) {
+		constraint := constraints[name]
+		schema.Properties[name] = variables[name].JSONSchema(constraint)
+		if variables[name].isRequiredInput(constraint) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// GenerateOpenAPIParameters returns one parameter per variable sorted by name, in is one of ParameterInQuery,
+// ParameterInHeader, ParameterInPath or ParameterInCookie. Path parameters are always required.
+func GenerateOpenAPIParameters(in string, variables map[string]*Variable, constraints map[string]Constraint) []OpenAPIParameter {
+	parameters := make([]OpenAPIParameter, 0, len(variables))
+
+	for _, name := range sortedVariableNames(variables) {
+		constraint := constraints[name]
+		parameters = append(parameters, OpenAPIParameter{
+			Name:     name,
+			In:       in,
+			Required: in == ParameterInPath || variables[name].isRequiredInput(constraint),
+			Schema:   variables[name].JSONSchema(constraint),
+		})
+	}
+
+	return parameters
+}
+
+// GenerateOpenAPIRequestBody returns a JSON request body with the schema of the variables, the body is required
+// when at least one variable is.
+func GenerateOpenAPIRequestBody(variables map[string]*Variable, constraints map[string]Constraint) *OpenAPIRequestBody {
+	schema := GenerateJSONSchema(variables, constraints)
+
+	return &OpenAPIRequestBody{
+		Required: len(schema.Required) > 0,
+		Content: map[string]OpenAPIMediaType{
+			"application/json": {Schema: schema},
+		},
+	}
+}
+
+// JSONSchema returns the schema of a single variable value.
+func (v *Variable) JSONSchema(constraint Constraint) *JSONSchema {
+	schema := &JSONSchema{}
+
+	switch v.Type {
+	case pbEndpoint.VariableType_VARIABLE_TYPE_STRING:
+		schema.Type = "string"
+	case pbEndpoint.VariableType_VARIABLE_TYPE_INT:
+		schema.Type, schema.Format = "integer", "int64"
+	case pbEndpoint.VariableType_VARIABLE_TYPE_FLOAT:
+		schema.Type, schema.Format = "number", "double"
+	case pbEndpoint.VariableType_VARIABLE_TYPE_BOOL:
+		schema.Type = "boolean"
+	case pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT:
+		schema.Type = "object"
+	case VariableTypeArray:
+		schema.Type, schema.Items = "array", &JSONSchema{}
+	case VariableTypeDatetime:
+		schema.Type, schema.Format = "string", "date-time"
+	case VariableTypeDuration:
+		schema.Type, schema.Format = "string", "duration"
+	case VariableTypeDecimal:
+		schema.Type, schema.Format = "string", "decimal"
+	case VariableTypeBytes:
+		schema.Type, schema.Format = "string", "byte"
+	}
+
+	if v.Default != "" {
+		schema.Default = v.schemaDefault()
+	}
+
+	schema.Minimum, schema.Maximum = constraint.Min, constraint.Max
+	if schema.Type == "array" || schema.Type == "object" {
+		schema.MinItems, schema.MaxItems = constraint.MinLength, constraint.MaxLength
+	} else {
+		schema.MinLength, schema.MaxLength = constraint.MinLength, constraint.MaxLength
+	}
+	schema.Pattern = constraint.Pattern
+	schema.Enum = constraint.Enum
+
+	switch constraint.Format {
+	case FormatURL:
+		schema.Format = "uri"
+	case FormatEmail, FormatUUID:
+		schema.Format = string(constraint.Format)
+	}
+
+	return schema
+}
+
+// schemaDefault returns the default with the JSON type of the schema, types serialized as strings keep the
+// default as is.
+func (v *Variable) schemaDefault() any {
+	switch v.Type {
+	case pbEndpoint.VariableType_VARIABLE_TYPE_INT,
+		pbEndpoint.VariableType_VARIABLE_TYPE_FLOAT,
+		pbEndpoint.VariableType_VARIABLE_TYPE_BOOL,
+		VariableTypeArray:
+		if value, err := v.parseValueByType(v.Default, v.Type, newOptions(nil)); err == nil {
+			return value
+		}
+	}
+
+	return v.Default
+}
+
+// isRequiredInput tells whether the caller must send the value, a required variable with a default is optional.
+func (v *Variable) isRequiredInput(constraint Constraint) bool {
+	return constraint.Required || (v.Required && v.Default == "")
+}
+
+func sortedVariableNames(variables map[string]*Variable) []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
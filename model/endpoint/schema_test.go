@@ -0,0 +1,87 @@
+package endpoint
+
+import (
+	"encoding/json"
+
+	"github.com/ideagate/core/utils"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schema", func() {
+	variables := map[string]*Variable{
+		"name":    {Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING, Required: true},
+		"age":     {Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT, Required: true, Default: "18"},
+		"active":  {Type: pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, Default: "false"},
+		"tags":    {Type: VariableTypeArray, Default: `["a"]`},
+		"since":   {Type: VariableTypeDatetime},
+		"price":   {Type: VariableTypeDecimal, Default: "1.50"},
+		"payload": {},
+	}
+	constraints := map[string]Constraint{
+		"name": {MinLength: utils.ToPtr(1), Pattern: "^[a-z]+$"},
+		"age":  {Min: utils.ToPtr(0.0), Max: utils.ToPtr(150.0)},
+		"tags": {MaxLength: utils.ToPtr(5)},
+		"since": {
+			Required: true,
+			Enum:     []any{"2024-01-01T00:00:00Z"},
+		},
+	}
+
+	marshal := func(value any) string {
+		b, err := json.Marshal(value)
+		Expect(err).To(BeNil())
+		return string(b)
+	}
+
+	It("GenerateJSONSchema", func() {
+		Expect(marshal(GenerateJSONSchema(variables, constraints))).To(MatchJSON(`{
+			"type": "object",
+			"properties": {
+				"active": {"type": "boolean", "default": false},
+				"age": {"type": "integer", "format": "int64", "default": 18, "minimum": 0, "maximum": 150},
+				"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+				"payload": {},
+				"price": {"type": "string", "format": "decimal", "default": "1.50"},
+				"since": {"type": "string", "format": "date-time", "enum": ["2024-01-01T00:00:00Z"]},
+				"tags": {"type": "array", "items": {}, "default": ["a"], "maxItems": 5}
+			},
+			"required": ["name", "since"]
+		}`))
+	})
+
+	It("GenerateOpenAPIParameters", func() {
+		parameters := GenerateOpenAPIParameters(ParameterInQuery, map[string]*Variable{
+			"page": {Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT, Required: true, Default: "1"},
+			"q":    {Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING, Required: true},
+		}, nil)
+		Expect(marshal(parameters)).To(MatchJSON(`[
+			{"name": "page", "in": "query", "schema": {"type": "integer", "format": "int64", "default": 1}},
+			{"name": "q", "in": "query", "required": true, "schema": {"type": "string"}}
+		]`))
+
+		parameters = GenerateOpenAPIParameters(ParameterInPath, map[string]*Variable{
+			"id": {Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING},
+		}, map[string]Constraint{"id": {Format: FormatUUID}})
+		Expect(marshal(parameters)).To(MatchJSON(`[
+			{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}}
+		]`))
+	})
+
+	It("GenerateOpenAPIRequestBody", func() {
+		body := GenerateOpenAPIRequestBody(map[string]*Variable{
+			"email": {Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING},
+		}, map[string]Constraint{"email": {Format: FormatEmail}})
+		Expect(marshal(body)).To(MatchJSON(`{
+			"content": {
+				"application/json": {
+					"schema": {
+						"type": "object",
+						"properties": {"email": {"type": "string", "format": "email"}}
+					}
+				}
+			}
+		}`))
+	})
+})
@@ -0,0 +1,210 @@
+package endpoint
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+const (
+	captureFuncName = "__capture"
+	tickFuncName    = "__tick"
+)
+
+var internalTemplateFuncs = template.FuncMap{
+	captureFuncName: captureValue,
+	tickFuncName:    tickExecution,
+}
+
+// compiledTemplate is a parsed variable template. When the template is a single expression such as
+// {{.Req.Json.json_2}}, the expression result is captured as a native value instead of being rendered.
+type compiledTemplate struct {
+	tmpl                *template.Template
+	isSingleExpression  bool
+	hasDefinedTemplates bool // inside a defined template $ is the call argument, the tick is bound per execution
+}
+
+const strictCacheKeyPrefix = "strict\x00"
+
+// getCompiledTemplate returns the cached compiled template. Strict templates are cached separately because
+// they are parsed with missingkey=error.
+func getCompiledTemplate(templateValue string, strict bool) (*compiledTemplate, error) {
+	if !strict {
+		return templateCache.getOrCompile(templateValue, func(key string) (*compiledTemplate, error) {
+			return compileTemplate(key, false)
+		})
+	}
+
+	return templateCache.getOrCompile(strictCacheKeyPrefix+templateValue, func(key string) (*compiledTemplate, error) {
+		return compileTemplate(strings.TrimPrefix(key, strictCacheKeyPrefix), true)
+	})
+}
+
+func compileTemplate(templateValue string, strict bool) (*compiledTemplate, error) {
+	tmpl := template.New("").Funcs(templateFuncs).Funcs(internalTemplateFuncs)
+	if strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+
+	tmpl, err := tmpl.Parse(templateValue)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &compiledTemplate{tmpl: tmpl}
+
+	if action := singleAction(tmpl.Tree, templateValue); action != nil {
+		captureCmd, err := newCaptureCommand()
+		if err != nil {
+			return nil, err
+		}
+
+		action.Pipe.Cmds = append(action.Pipe.Cmds, captureCmd)
+		compiled.isSingleExpression = true
+	}
+
+	if err = addTicks(tmpl); err != nil {
+		return nil, err
+	}
+	compiled.hasDefinedTemplates = len(tmpl.Templates()) > 1
+
+	return compiled, nil
+}
+
+// execute runs the template against data. Single expressions return the native value, other templates
+// return the rendered text.
+func (c *compiledTemplate) execute(data *variableData) (any, error) {
+	state := data.state
+	cancel, err := state.start()
+	defer cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := c.tmpl
+	if c.hasDefinedTemplates {
+		cloned, err := tmpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		tmpl = cloned.Funcs(template.FuncMap{
+			tickFuncName: func(_ any, isIteration bool) (string, error) {
+				return "", state.tick(isIteration)
+			},
+		})
+	}
+
+	writer := &limitedWriter{state: state}
+	if err := tmpl.Execute(writer, data); err != nil {
+		return nil, err
+	}
+
+	if c.isSingleExpression {
+		if err := state.checkOutputSize(data.captured); err != nil {
+			return nil, err
+		}
+		return data.captured, nil
+	}
+
+	return writer.buffer.String(), nil
+}
+
+// singleAction returns the action node when the whole template, ignoring surrounding spaces, is one
+// expression that produces output.
+func singleAction(tree *parse.Tree, templateValue string) *parse.ActionNode {
+	if tree == nil || tree.Root == nil || !strings.HasPrefix(strings.TrimSpace(templateValue), "{{") {
+		return nil
+	}
+
+	var action *parse.ActionNode
+	for _, node := range tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if len(bytes.TrimSpace(n.Text)) != 0 {
+				return nil
+			}
+		case *parse.ActionNode:
+			if action != nil || len(n.Pipe.Decl) != 0 {
+				return nil
+			}
+			action = n
+		default:
+			return nil
+		}
+	}
+
+	return action
+}
+
+// newCaptureCommand builds the "__capture $" command that receives the pipeline result as last argument.
+func newCaptureCommand() (*parse.CommandNode, error) {
+	tmpl, err := template.New("").Funcs(internalTemplateFuncs).Parse("{{. | " + captureFuncName + " $}}")
+	if err != nil {
+		return nil, err
+	}
+
+	action := tmpl.Tree.Root.Nodes[0].(*parse.ActionNode)
+	return action.Pipe.Cmds[1], nil
+}
+
+func captureValue(data *variableData, value any) string {
+	data.captured = value
+	return ""
+}
+
+// addTicks calls tickExecution at the start of every range iteration and every defined template, so limits
+// are checked even when nothing is written.
+func addTicks(tmpl *template.Template) error {
+	tickTmpl, err := template.New("").Funcs(internalTemplateFuncs).Parse(
+		"{{" + tickFuncName + " $ true}}{{" + tickFuncName + " $ false}}")
+	if err != nil {
+		return err
+	}
+	iterationTick, callTick := tickTmpl.Tree.Root.Nodes[0], tickTmpl.Tree.Root.Nodes[1]
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+
+		addRangeTicks(t.Tree.Root, iterationTick)
+		if t.Name() != tmpl.Name() {
+			t.Tree.Root.Nodes = append([]parse.Node{callTick}, t.Tree.Root.Nodes...)
+		}
+	}
+
+	return nil
+}
+
+func addRangeTicks(node parse.Node, tick parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			addRangeTicks(child, tick)
+		}
+
+	case *parse.RangeNode:
+		addRangeTicks(n.List, tick)
+		addRangeTicks(n.ElseList, tick)
+		n.List.Nodes = append([]parse.Node{tick}, n.List.Nodes...)
+
+	case *parse.IfNode:
+		addRangeTicks(n.List, tick)
+		addRangeTicks(n.ElseList, tick)
+
+	case *parse.WithNode:
+		addRangeTicks(n.List, tick)
+		addRangeTicks(n.ElseList, tick)
+	}
+}
+
+func tickExecution(data any, isIteration bool) (string, error) {
+	if data, ok := data.(*variableData); ok {
+		return "", data.state.tick(isIteration)
+	}
+	return "", nil
+}
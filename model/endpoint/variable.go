@@ -1,10 +1,9 @@
 package endpoint
 
 import (
-	"bytes"
-	"reflect"
+	"errors"
+	"fmt"
 	"strings"
-	"text/template"
 
 	entityContext "github.com/ideagate/core/model/entity/context"
 	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
@@ -13,104 +12,292 @@ import (
 
 type Variable pbEndpoint.Variable
 
-func (v *Variable) GetValue(stepId string, ctxData *entityContext.ContextData) (interface{}, error) {
-	var result any = v.Value
+// GetValue resolves the value of the variable from a view of the context data, see ContextData.View, a literal
+// doesn't read the context. The view is never changed as the context data copies each value when it's set. The
+// value is a copy the caller can change. ResolveVariables takes a single view for every variable of a step.
+func (v *Variable) GetValue(stepId string, ctxData *entityContext.ContextData, opts ...Option) (interface{}, error) {
+	var (
+		opt    = newOptions(opts)
+		policy = opt.valuePolicy()
+		result any
+		state  ValueState
+		err    error
+	)
+
+	if opt.err != nil {
+		return nil, v.newError(stepId, opt, "", opt.err)
+	}
+
+	var (
+		evaluator, expression, isExpression = lookupEvaluator(v.Value, opt.syntax)
+		isPath                              = !isExpression && isPathExpression(v.Value, opt.syntax)
+		isLiteral                           = !isExpression && !isPath && !strings.Contains(v.Value, "{{")
+	)
+
+	// read from a view so other steps can write into the context meanwhile
+	if !opt.isView && !isLiteral {
+		ctxData = ctxData.View()
+	}
 
 	// get value from context
-	result = v.getValueFromTemplate(stepId, ctxData, v.Value)
+	if isExpression {
+		result, state, err = v.getValueFromExpression(stepId, ctxData, evaluator, expression, opt)
+	} else if isPath {
+		result, state, err = v.getValueFromPath(stepId, ctxData, v.Value, opt)
+	} else {
+		result, state, err = v.getValueFromTemplate(stepId, ctxData, v.Value, opt)
+	}
+	if err != nil {
+		// a missing value can still be replaced by the default
+		if !errors.Is(err, ErrMissingValue) || !v.Required || v.Default == "" || policy.Default&ValueMissing == 0 {
+			return nil, err
+		}
+		result, state = nil, ValueMissing
+	}
+
+	// a native value is shared with the context data
+	if !isLiteral {
+		result = entityContext.DeepCopy(result)
+	}
 
 	// parse value by type
-	result, err := v.parseValueByType(result, v.Type)
+	result, err = v.parseValueByType(result, v.Type, opt)
 	if err != nil {
-		return nil, err
+		return nil, v.newError(stepId, opt, "", err)
 	}
 
-	// check is value empty
-	if v.isEmptyValue(result) && v.Required {
-		// set into default and parse the default value
-		result, err = v.parseValueByType(v.Default, v.Type)
+	// a required value is replaced by the default or fails depending on its state
+	if v.Required {
+		state = valueState(result, state)
+
+		switch {
+		case policy.Default&state != 0 && v.Default != "":
+			result, err = v.parseValueByType(v.Default, v.Type, opt)
+			if err != nil {
+				return nil, v.newError(stepId, opt, "", err)
+			}
+		case policy.Required&state != 0:
+			return nil, v.newError(stepId, opt, "", fmt.Errorf("%w: value is %s", ErrRequiredValue, state))
+		case policy.Default&state != 0:
+			// without default, the empty value is parsed by type as before the policies, ex: "" for a string
+			result, err = v.parseValueByType("", v.Type, opt)
+			if err != nil {
+				return nil, v.newError(stepId, opt, "", err)
+			}
+		}
+	}
+
+	// check constraint
+	if opt.constraint != nil {
+		violations, err := opt.constraint.validate(opt.name, result, result == nil || result == "")
 		if err != nil {
-			return nil, err
+			return nil, v.newError(stepId, opt, "", err)
+		}
+		if len(violations) > 0 {
+			return nil, v.newError(stepId, opt, "", &ValidationError{Violations: violations})
 		}
 	}
 
 	return result, nil
 }
 
-func (v *Variable) GetValueString(stepId string, ctxData *entityContext.ContextData) (string, error) {
-	value, err := v.GetValue(stepId, ctxData)
+func (v *Variable) GetValueString(stepId string, ctxData *entityContext.ContextData, opts ...Option) (string, error) {
+	value, err := v.GetValue(stepId, ctxData, opts...)
 	if err != nil {
 		return "", err
 	}
 
-	return cast.ToStringE(value)
+	return castValue(value, "string", cast.ToStringE)
 }
 
-func (v *Variable) getValueFromTemplate(stepId string, ctxData *entityContext.ContextData, templateValue string) interface{} {
-	tmpl, err := template.New("").Parse(templateValue)
+func (v *Variable) getValueFromTemplate(stepId string, ctxData *entityContext.ContextData, templateValue string, opt *options) (interface{}, ValueState, error) {
+	// a value without actions is a literal, no need to execute a template
+	if !strings.Contains(templateValue, "{{") {
+		if templateValue == "" {
+			return nil, ValueMissing, nil
+		}
+		return templateValue, ValuePresent, nil
+	}
+
+	tmpl, err := getCompiledTemplate(templateValue, opt.strict)
+	if err != nil {
+		if opt.strict {
+			return nil, ValueMissing, v.newError(stepId, opt, "", err)
+		}
+		return nil, ValueMissing, nil
+	}
 
+	result, err := tmpl.execute(newVariableData(stepId, ctxData, opt))
 	if err != nil {
-		return nil
+		if isLimitError(err) {
+			return nil, ValueMissing, v.newError(stepId, opt, "", err)
+		}
+		if opt.strict {
+			path, cause := parseExecError(err)
+			return nil, ValueMissing, v.newError(stepId, opt, path, cause)
+		}
+		return nil, ValueMissing, nil
 	}
 
-	type dataTemplateType struct {
-		Req  entityContext.ContextRequestData
-		Step map[string]entityContext.ContextStepData
-		Var  map[string]any
-		Data entityContext.ContextStepDataBody
+	// a single expression keeps the native value, ex: map, slice, number or bool
+	if !tmpl.isSingleExpression {
+		result = strings.ReplaceAll(result.(string), "<no value>", "")
 	}
 
-	data := dataTemplateType{
+	if result != nil && result != "" {
+		return result, ValuePresent, nil
+	}
+
+	if !v.Required {
+		return nil, ValueMissing, nil
+	}
+
+	// only a required variable needs to know whether the value is missing, null or an empty string
+	return v.templateEmptyValueState(stepId, ctxData, templateValue, result, opt)
+}
+
+// templateEmptyValueState tells a missing value from a null value or an empty string by executing the
+// template again with missingkey=error.
+func (v *Variable) templateEmptyValueState(stepId string, ctxData *entityContext.ContextData, templateValue string, result any, opt *options) (interface{}, ValueState, error) {
+	if !opt.strict {
+		tmpl, err := getCompiledTemplate(templateValue, true)
+		if err != nil {
+			return nil, ValueMissing, nil
+		}
+
+		result, err = tmpl.execute(newVariableData(stepId, ctxData, opt))
+		if err != nil {
+			if isLimitError(err) {
+				return nil, ValueMissing, v.newError(stepId, opt, "", err)
+			}
+			return nil, ValueMissing, nil
+		}
+	}
+
+	if result == nil {
+		return nil, ValueNull, nil
+	}
+
+	return "", ValueZero, nil
+}
+
+// getValueFromPath resolves a path expression such as $.Step.<StepId>.Data.Query.query_1[0].col_a
+// and returns the native value.
+func (v *Variable) getValueFromPath(stepId string, ctxData *entityContext.ContextData, pathValue string, opt *options) (interface{}, ValueState, error) {
+	path, err := pathCache.getOrCompile(pathValue, compilePath)
+	if err != nil {
+		return nil, ValueMissing, v.newError(stepId, opt, "", err)
+	}
+
+	data := newVariableData(stepId, ctxData, opt)
+	cancel, err := data.state.start()
+	defer cancel()
+	if err != nil {
+		return nil, ValueMissing, v.newError(stepId, opt, "", err)
+	}
+
+	result, found, err := path.evaluate(data, data.state)
+	if err == nil {
+		err = data.state.checkOutputSize(result)
+	}
+	if err != nil {
+		return nil, ValueMissing, v.newError(stepId, opt, "", err)
+	}
+	if !found {
+		if opt.strict {
+			return nil, ValueMissing, v.newError(stepId, opt, strings.TrimSpace(pathValue), ErrMissingValue)
+		}
+		return nil, ValueMissing, nil
+	}
+
+	return result, valueState(result, ValueNull), nil
+}
+
+// variableData is the root object that templates and path expressions are evaluated against.
+type variableData struct {
+	Req  entityContext.ContextRequestData
+	Step map[string]entityContext.ContextStepData
+	Var  map[string]any
+	Data entityContext.ContextStepDataBody
+
+	// variables shared by every step, see ContextData.SetGlobal
+	Global map[string]any
+
+	// current iteration, see ContextData.NewIteration
+	Item  any
+	Index int
+	Frame *entityContext.ContextFrame
+
+	captured any             // result of a single expression template
+	state    *executionState // limits of the template execution
+}
+
+func newVariableData(stepId string, ctxData *entityContext.ContextData, opt *options) *variableData {
+	data := &variableData{
 		Req:  ctxData.Req,
 		Step: ctxData.Step,
 		Var:  ctxData.Step[stepId].Var,
 		Data: ctxData.Step[stepId].Data,
-	}
 
-	var resultBuffer bytes.Buffer
-	if err = tmpl.Execute(&resultBuffer, data); err != nil {
-		return nil
+		Global: ctxData.Global,
+
+		state: &executionState{ctx: opt.ctx, limits: opt.limits},
 	}
 
-	result := resultBuffer.String()
-	result = strings.ReplaceAll(result, "<no value>", "")
+	if frame := ctxData.Frame; frame != nil {
+		data.Item, data.Index, data.Frame = frame.Item, frame.Index, frame
+	}
 
-	if result == "" {
-		return nil
+	if len(opt.stepVariables) > 0 {
+		vars := make(map[string]any, len(data.Var)+len(opt.stepVariables))
+		for key, value := range data.Var {
+			vars[key] = value
+		}
+		for key, value := range opt.stepVariables {
+			vars[key] = value
+		}
+		data.Var = vars
 	}
 
-	return result
+	return data
 }
 
-func (v *Variable) parseValueByType(value interface{}, varType pbEndpoint.VariableType) (interface{}, error) {
+func (v *Variable) parseValueByType(value interface{}, varType pbEndpoint.VariableType, opt *options) (interface{}, error) {
 	if value == nil {
 		return nil, nil
 	}
 
 	switch varType {
 	case pbEndpoint.VariableType_VARIABLE_TYPE_STRING:
-		return cast.ToStringE(value)
+		return castValue(value, "string", cast.ToStringE)
 
 	case pbEndpoint.VariableType_VARIABLE_TYPE_INT:
-		return cast.ToInt64E(value)
+		return castValue(value, "int64", cast.ToInt64E)
 
 	case pbEndpoint.VariableType_VARIABLE_TYPE_FLOAT:
-		return cast.ToFloat64E(value)
+		return castValue(value, "float64", cast.ToFloat64E)
 
 	case pbEndpoint.VariableType_VARIABLE_TYPE_BOOL:
-		return cast.ToBoolE(value)
+		return castValue(value, "bool", cast.ToBoolE)
 
 	case pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT:
 		return value, nil
-	}
 
-	return value, nil
-}
+	case VariableTypeArray:
+		return v.parseArray(value, opt)
 
-func (v *Variable) isEmptyValue(value interface{}) bool {
-	if value == nil {
-		return true
+	case VariableTypeDatetime:
+		return parseDatetime(value, opt.timeLayout)
+
+	case VariableTypeDuration:
+		return castValue(value, "duration", cast.ToDurationE)
+
+	case VariableTypeDecimal:
+		return parseDecimal(value)
+
+	case VariableTypeBytes:
+		return parseBytes(value)
 	}
 
-	return reflect.ValueOf(value).IsZero()
+	return value, nil
 }
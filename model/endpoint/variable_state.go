@@ -0,0 +1,75 @@
+package endpoint
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// ValueState tells how a value was found in the context before the default is applied. States are flags so
+// a ValuePolicy can combine them.
+type ValueState uint8
+
+const (
+	ValueMissing ValueState = 1 << iota // the key, index or step doesn't exist
+	ValueNull                           // the key exists with a null value, ex: {"flag": null}
+	ValueZero                           // the value is present with its zero value, ex: 0, false or ""
+	ValuePresent                        // the value is present and not zero
+)
+
+func (s ValueState) String() string {
+	var names []string
+	for _, state := range []struct {
+		state ValueState
+		name  string
+	}{{ValueMissing, "missing"}, {ValueNull, "null"}, {ValueZero, "zero"}, {ValuePresent, "present"}} {
+		if s&state.state != 0 {
+			names = append(names, state.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ValuePolicy tells which states of a required variable are replaced by its default, and which fail with
+// ErrRequiredValue when the variable has no default. A variable that is not required keeps its value as is.
+// Without default, the value is parsed from "" unless Required has the state, ex: "" for a string.
+type ValuePolicy struct {
+	Default  ValueState
+	Required ValueState
+}
+
+// DefaultValuePolicy keeps a supplied 0, false or "", only missing and null values use the default. No state
+// fails, set Required to get ErrRequiredValue instead of the empty default.
+var DefaultValuePolicy = ValuePolicy{
+	Default: ValueMissing | ValueNull,
+}
+
+// ErrRequiredValue is returned when a required variable has no usable value and no default.
+var ErrRequiredValue = errors.New("required value")
+
+// valueState returns the state of a resolved value, nilState is used when the value is nil because only the
+// source knows whether it's missing or null.
+func valueState(value any, nilState ValueState) ValueState {
+	if value == nil {
+		return nilState
+	}
+
+	if reflect.ValueOf(value).IsZero() {
+		return ValueZero
+	}
+
+	return ValuePresent
+}
+
+// valuePolicy returns the policy of the variable named by WithName, falling back to the policy set for every
+// variable and then to DefaultValuePolicy.
+func (o *options) valuePolicy() ValuePolicy {
+	if policy, ok := o.valuePolicies[o.name]; ok {
+		return policy
+	}
+	if o.defaultValuePolicy != nil {
+		return *o.defaultValuePolicy
+	}
+	return DefaultValuePolicy
+}
@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Value State", func() {
+	mockStepId := "mockStepId"
+
+	mockCtxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Json: map[string]any{
+				"null":  nil,
+				"false": false,
+				"zero":  0,
+				"empty": "",
+				"text":  "value",
+			},
+		},
+	}
+
+	DescribeTable("DefaultValuePolicy", func(value string, varType pbEndpoint.VariableType, want any) {
+		variable := &Variable{Value: value, Type: varType, Required: true, Default: "1"}
+		got, err := variable.GetValue(mockStepId, mockCtxData, WithSyntax(SyntaxPath|SyntaxExpression))
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(want))
+	},
+		Entry("template - missing", "{{.Req.Json.unknown}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+		Entry("template - missing parent", "{{.Req.Json.unknown.child}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+		Entry("template - null", "{{.Req.Json.null}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+		Entry("template - false", "{{.Req.Json.false}}", pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, false),
+		Entry("template - zero", "{{.Req.Json.zero}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(0)),
+		Entry("template - empty string", "{{.Req.Json.empty}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, ""),
+		Entry("template - present", "{{.Req.Json.text}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "value"),
+		Entry("path - missing", "$.Req.Json.unknown", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+		Entry("path - null", "$.Req.Json.null", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+		Entry("path - false", "$.Req.Json.false", pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, false),
+		Entry("path - zero", "$.Req.Json.zero", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(0)),
+		Entry("expression - null", "expr:Req.Json.null", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+		Entry("expression - false", "expr:Req.Json.false", pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, false),
+		Entry("literal - empty", "", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+	)
+
+	DescribeTable("ValuePolicy", func(value string, policy ValuePolicy, want any, wantErr error) {
+		variable := &Variable{Value: value, Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT, Required: true, Default: "1"}
+		got, err := variable.GetValue(mockStepId, mockCtxData, WithSyntax(SyntaxPath|SyntaxExpression), WithValuePolicy(policy))
+		switch {
+		case wantErr != nil:
+			Expect(err).To(MatchError(wantErr))
+			Expect(got).To(BeNil())
+		case want == nil:
+			Expect(err).To(BeNil())
+			Expect(got).To(BeNil())
+		default:
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal(want))
+		}
+	},
+		Entry("zero uses the default", "{{.Req.Json.zero}}", ValuePolicy{Default: ValueZero}, int64(1), nil),
+		Entry("null is kept", "{{.Req.Json.null}}", ValuePolicy{Default: ValueMissing}, nil, nil),
+		Entry("null fails", "{{.Req.Json.null}}", ValuePolicy{Default: ValueMissing, Required: ValueNull}, nil, ErrRequiredValue),
+		Entry("missing fails", "$.Req.Json.unknown", ValuePolicy{Required: ValueMissing}, nil, ErrRequiredValue),
+		Entry("missing uses the default", "$.Req.Json.unknown", ValuePolicy{Default: ValueMissing, Required: ValueMissing}, int64(1), nil),
+	)
+
+	It("required without default", func() {
+		// the empty default is parsed by type
+		variable := &Variable{Value: "{{.Req.Json.unknown}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING, Required: true}
+		got, err := variable.GetValue(mockStepId, mockCtxData)
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(""))
+
+		// the required error is opt-in
+		_, err = variable.GetValue(mockStepId, mockCtxData, WithName("flag"),
+			WithValuePolicy(ValuePolicy{Default: ValueMissing | ValueNull, Required: ValueMissing | ValueNull}))
+		Expect(err).To(MatchError(ErrRequiredValue))
+		Expect(err.Error()).To(ContainSubstring("value is missing"))
+
+		// not required keeps the empty value
+		variable.Required = false
+		got, err = variable.GetValue(mockStepId, mockCtxData)
+		Expect(err).To(BeNil())
+		Expect(got).To(BeNil())
+	})
+
+	It("strict mode with a null value", func() {
+		variable := &Variable{Value: "{{.Req.Json.null}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT, Required: true, Default: "1"}
+		got, err := variable.GetValue(mockStepId, mockCtxData, WithStrict())
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(int64(1)))
+	})
+
+	It("WithValuePolicies per variable", func() {
+		variables := map[string]*Variable{
+			"flag":  {Value: "{{.Req.Json.false}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, Required: true, Default: "true"},
+			"count": {Value: "{{.Req.Json.zero}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_INT, Required: true, Default: "10"},
+		}
+
+		values, err := ResolveVariables(mockStepId, mockCtxData, variables, WithValuePolicies(map[string]ValuePolicy{
+			"count": {Default: ValueMissing | ValueNull | ValueZero},
+		}))
+		Expect(err).To(BeNil())
+		Expect(values).To(Equal(map[string]any{"flag": false, "count": int64(10)}))
+	})
+})
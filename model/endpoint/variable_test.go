@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"errors"
 	"testing"
 
 	entityContext "github.com/ideagate/core/model/entity/context"
@@ -311,13 +312,26 @@ var _ = Describe("Variable", func() {
 						Type:  pbEndpoint.VariableType_VARIABLE_TYPE_INT,
 					}, int64(0), false)
 				})
-				It("{{.Step.<StepId>.Data.StatusCode}} - using default", func() {
+				It("{{.Step.<StepId>.Data.StatusCode}} - zero keeps the value", func() {
 					runTest(&Variable{
 						Value:    "{{.Step.mockAnotherStep2.Data.StatusCode}}",
 						Type:     pbEndpoint.VariableType_VARIABLE_TYPE_INT,
 						Required: true,
 						Default:  "500",
-					}, int64(500), false)
+					}, int64(0), false)
+				})
+				It("{{.Step.<StepId>.Data.StatusCode}} - using default", func() {
+					variable := &Variable{
+						Value:    "{{.Step.mockAnotherStep2.Data.StatusCode}}",
+						Type:     pbEndpoint.VariableType_VARIABLE_TYPE_INT,
+						Required: true,
+						Default:  "500",
+					}
+					got, err := variable.GetValue(mockStepId, mockCtxData, WithValuePolicy(ValuePolicy{
+						Default: ValueMissing | ValueNull | ValueZero,
+					}))
+					Expect(got).To(Equal(int64(500)))
+					Expect(err).To(BeNil())
 				})
 			})
 		})
@@ -428,37 +442,284 @@ var _ = Describe("Variable", func() {
 			})
 		})
 	})
+	Describe("From Request Capture", func() {
+		captureCtxData := &entityContext.ContextData{}
+		captureCtxData.SetRequestMethod("POST")
+		captureCtxData.SetRequestPath("/users/123")
+		captureCtxData.SetRequestHost("api.example.com")
+		captureCtxData.SetRequestClientIP("10.0.0.1")
+		captureCtxData.SetRequestParam(map[string]any{"id": "123"})
+		captureCtxData.SetRequestCookie(map[string]any{"session": "abc"})
+		captureCtxData.SetRequestForm(map[string]any{"name": "John", "tags": []any{"a", "b"}})
+		captureCtxData.SetRequestFile(map[string][]entityContext.ContextRequestFile{
+			"avatar": {{Filename: "me.png", ContentType: "image/png", Size: 2048}},
+		})
+		captureCtxData.SetRequestRawBody([]byte("name=John"))
+
+		DescribeTable("GetValue", func(value string, varType pbEndpoint.VariableType, want any) {
+			got, err := (&Variable{Value: value, Type: varType}).GetValue(mockStepId, captureCtxData, WithSyntax(SyntaxPath|SyntaxExpression))
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal(want))
+		},
+			Entry("{{.Req.Method}}", "{{.Req.Method}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "POST"),
+			Entry("{{.Req.Path}}", "{{.Req.Host}}{{.Req.Path}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "api.example.com/users/123"),
+			Entry("{{.Req.ClientIP}}", "{{.Req.ClientIP}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "10.0.0.1"),
+			Entry("{{.Req.Param.<Key>}}", "{{.Req.Param.id}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(123)),
+			Entry("{{.Req.Cookie.<Key>}}", "{{.Req.Cookie.session}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "abc"),
+			Entry("{{.Req.Form.<Key>}}", "{{index .Req.Form.tags 1}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "b"),
+			Entry("{{.Req.File.<Key>}}", "{{(index .Req.File.avatar 0).Filename}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "me.png"),
+			Entry("$.Req.File.<Key>", "$.Req.File.avatar[0].Size", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(2048)),
+			Entry("{{.Req.RawBody}}", "{{.Req.RawBody | toString}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "name=John"),
+			Entry("expr:Req.Form", "expr:Req.Method == 'POST' && 'avatar' in Req.File", pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, true),
+		)
+	})
+
+	Describe("From Iteration", func() {
+		loopCtxData := &entityContext.ContextData{}
+		loopCtxData.SetStepDataBody("mysql", []map[string]any{{"name": "John"}, {"name": "Jane"}})
+		loopCtxData.SetStepOutput("transform", map[string]any{"name": "parent"})
+
+		iteration := loopCtxData.NewIteration("foreach", 1, map[string]any{"name": "Jane"})
+		iteration.SetStepOutput("transform", map[string]any{"name": "JANE"})
+
+		nested := iteration.NewIteration("inner", 0, "tag")
+
+		DescribeTable("GetValue", func(ctxData *entityContext.ContextData, value string, varType pbEndpoint.VariableType, want any) {
+			got, err := (&Variable{Value: value, Type: varType}).GetValue("transform", ctxData, WithSyntax(SyntaxPath|SyntaxExpression))
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal(want))
+		},
+			Entry("{{.Item.<Key>}}", iteration, "{{.Item.name}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "Jane"),
+			Entry("{{.Index}}", iteration, "{{.Index}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(1)),
+			Entry("$.Item.<Key>", iteration, "$.Item.name", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "Jane"),
+			Entry("expr:Item", iteration, "expr:upper(Item.name) + '-' + Frame.StepId", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "JANE-foreach"),
+			Entry("parent step data", iteration, "{{index .Step.mysql.Data.Body .Index | get \"name\"}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "Jane"),
+			Entry("iteration step data", iteration, "{{.Step.transform.Out.name}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "JANE"),
+			Entry("parent outside of the iteration", loopCtxData, "{{.Step.transform.Out.name}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "parent"),
+			Entry("nested iteration", nested, "{{.Item}} of {{.Frame.Parent.Item.name}}", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "tag of Jane"),
+		)
+	})
+
+	Describe("From Global", func() {
+		globalCtxData := &entityContext.ContextData{}
+		globalCtxData.SetGlobal("user_id", 42)
+		globalCtxData.SetGlobal("user", map[string]any{"role": "admin"})
+
+		DescribeTable("GetValue", func(value string, varType pbEndpoint.VariableType, want any) {
+			got, err := (&Variable{Value: value, Type: varType}).GetValue(mockStepId, globalCtxData, WithSyntax(SyntaxPath|SyntaxExpression))
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal(want))
+		},
+			Entry("{{.Global.<Key>}}", "{{.Global.user_id}}", pbEndpoint.VariableType_VARIABLE_TYPE_INT, int64(42)),
+			Entry("$.Global.<Key>", "$.Global.user.role", pbEndpoint.VariableType_VARIABLE_TYPE_STRING, "admin"),
+			Entry("expr:Global", "expr:Global.user.role == 'admin'", pbEndpoint.VariableType_VARIABLE_TYPE_BOOL, true),
+		)
+
+		It("{{.Global.<Key>}} - from an iteration", func() {
+			iteration := globalCtxData.NewIteration("foreach", 0, nil)
+			Expect(iteration.SetGlobal("last", "iteration")).To(Succeed())
+
+			got, err := (&Variable{Value: "{{.Global.user_id}}-{{.Global.last}}", Type: pbEndpoint.VariableType_VARIABLE_TYPE_STRING}).GetValue(mockStepId, iteration)
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal("42-iteration"))
+		})
+	})
+
+	Describe("Native Type", func() {
+		It("{{.Req.Json.<Key>}} - object", func() {
+			runTest(&Variable{
+				Value: "{{.Req.Json.json_2}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, map[string]any{"json_2_a": 123}, false)
+		})
+		It("{{.Step.<StepId>.Data.Query.<QueryId>}} - rows", func() {
+			runTest(&Variable{
+				Value: "{{.Step.mockAnotherStep.Data.Query.query_1}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, []any{
+				map[string]any{"col_a": "val_a_1", "col_b": "val_b_1"},
+				map[string]any{"col_a": "val_a_2", "col_b": "val_b_2"},
+			}, false)
+		})
+		It("{{.Req.Query.<Key>}} - number with surrounding spaces", func() {
+			runTest(&Variable{
+				Value: " {{ .Req.Query.query_2 }} ",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, 12345, false)
+		})
+		It("{{.Step.<StepId>.Data.Body.<Key>}} - bool", func() {
+			runTest(&Variable{
+				Value: "{{.Step.mockAnotherStep.Data.Body.body_2}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, true, false)
+		})
+		It("mixed text - rendered as string", func() {
+			runTest(&Variable{
+				Value: "id-{{.Req.Query.query_2}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, "id-12345", false)
+		})
+		It("multiple expressions - rendered as string", func() {
+			runTest(&Variable{
+				Value: "{{.Req.Query.query_2}}{{.Req.Json.json_2.json_2_a}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, "12345123", false)
+		})
+		It("literal", func() {
+			runTest(&Variable{
+				Value: "plain value",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_OBJECT,
+			}, "plain value", false)
+		})
+	})
+	Describe("Strict Mode", func() {
+		runStrictTest := func(variable *Variable) (any, *VariableError) {
+			got, err := variable.GetValue(mockStepId, mockCtxData, WithStrict(), WithName("mockVar"), WithSyntax(SyntaxPath))
+			if err == nil {
+				return got, nil
+			}
+
+			var variableErr *VariableError
+			Expect(errors.As(err, &variableErr)).To(BeTrue())
+			Expect(variableErr.StepId).To(Equal(mockStepId))
+			Expect(variableErr.Name).To(Equal("mockVar"))
+			Expect(variableErr.Template).To(Equal(variable.Value))
+			return got, variableErr
+		}
+
+		It("{{.Req.Header.<Key>}} - exist", func() {
+			got, err := runStrictTest(&Variable{
+				Value: "{{.Req.Header.header_1}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			})
+			Expect(got).To(Equal("value_header_1"))
+			Expect(err).To(BeNil())
+		})
+		It("{{.Req.Header.<Key>}} - not exist", func() {
+			got, err := runStrictTest(&Variable{
+				Value: "{{.Req.Header.unknown}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			})
+			Expect(got).To(BeNil())
+			Expect(err).To(MatchError(ErrMissingValue))
+			Expect(err.Path).To(Equal(".Req.Header.unknown"))
+		})
+		It("{{.Step.<StepId>.Var.<Key>}} - invalid step id inside text", func() {
+			got, err := runStrictTest(&Variable{
+				Value: "value-{{.Step.unknown.Var.var_1}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			})
+			Expect(got).To(BeNil())
+			Expect(err).To(MatchError(ErrMissingValue))
+			Expect(err.Path).To(Equal(".Step.unknown.Var.var_1"))
+		})
+		It("{{.Req.Header.<Key>}} - using default", func() {
+			got, err := runStrictTest(&Variable{
+				Value:    "{{.Req.Header.unknown}}",
+				Type:     pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+				Required: true,
+				Default:  "default_value",
+			})
+			Expect(got).To(Equal("default_value"))
+			Expect(err).To(BeNil())
+		})
+		It("{{.Req.Unknown}} - invalid field", func() {
+			got, err := runStrictTest(&Variable{
+				Value:    "{{.Req.Unknown}}",
+				Type:     pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+				Required: true,
+				Default:  "default_value",
+			})
+			Expect(got).To(BeNil())
+			Expect(err).NotTo(MatchError(ErrMissingValue))
+			Expect(err.Path).To(Equal(".Req.Unknown"))
+		})
+		It("invalid template", func() {
+			got, err := runStrictTest(&Variable{
+				Value: "{{.Req.Header.header_1",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			})
+			Expect(got).To(BeNil())
+			Expect(err).To(HaveOccurred())
+
+			// without strict mode the error is ignored
+			runTest(&Variable{
+				Value: "{{.Req.Header.header_1",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			}, nil, false)
+		})
+		It("$.Req.Json.<Key> - path not exist", func() {
+			got, err := runStrictTest(&Variable{
+				Value: "$.Req.Json.unknown",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_STRING,
+			})
+			Expect(got).To(BeNil())
+			Expect(err).To(MatchError(ErrMissingValue))
+			Expect(err.Path).To(Equal("$.Req.Json.unknown"))
+		})
+		It("invalid type", func() {
+			got, err := runStrictTest(&Variable{
+				Value: "{{.Req.Header.header_1}}",
+				Type:  pbEndpoint.VariableType_VARIABLE_TYPE_INT,
+			})
+			Expect(got).To(BeNil())
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
 
-func TestVariable_isEmptyValue(t *testing.T) {
+func TestValueState(t *testing.T) {
 	type args struct {
-		value interface{}
+		value    interface{}
+		nilState ValueState
 	}
 	tests := []struct {
 		name string
 		args args
-		want bool
+		want ValueState
 	}{
 		{
-			name: "nil",
+			name: "nil - missing",
+			args: args{
+				value:    nil,
+				nilState: ValueMissing,
+			},
+			want: ValueMissing,
+		},
+		{
+			name: "nil - null",
 			args: args{
-				value: nil,
+				value:    nil,
+				nilState: ValueNull,
 			},
-			want: true,
+			want: ValueNull,
 		},
 		{
-			name: "int64 - empty",
+			name: "int64 - zero",
 			args: args{
 				value: int64(0),
 			},
-			want: true,
+			want: ValueZero,
+		},
+		{
+			name: "bool - zero",
+			args: args{
+				value: false,
+			},
+			want: ValueZero,
+		},
+		{
+			name: "string - present",
+			args: args{
+				value: "value",
+			},
+			want: ValuePresent,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			v := &Variable{}
-			if got := v.isEmptyValue(tt.args.value); got != tt.want {
-				t.Errorf("isEmptyValue() = %v, want %v", got, tt.want)
+			if got := valueState(tt.args.value, tt.args.nilState); got != tt.want {
+				t.Errorf("valueState() = %v, want %v", got, tt.want)
 			}
 		})
 	}
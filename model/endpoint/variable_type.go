@@ -0,0 +1,234 @@
+package endpoint
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	"github.com/spf13/cast"
+)
+
+// Variable types that are not part of the protobuf enum yet. The values are kept far from the protobuf ones
+// so they don't collide when the enum grows.
+const (
+	// VariableTypeArray is a list, elements are parsed with the type set by WithElementType.
+	// Accepts slices, JSON arrays and comma separated strings.
+	VariableTypeArray pbEndpoint.VariableType = 100 + iota
+	// VariableTypeDatetime is a time.Time. Strings are parsed with the layout set by WithTimeLayout,
+	// or with the cast formats (RFC3339 and friends) when no layout is set.
+	VariableTypeDatetime
+	// VariableTypeDuration is a time.Duration, ex: "1h30m". Integers are nanoseconds.
+	VariableTypeDuration
+	// VariableTypeDecimal is an arbitrary precision number kept as json.Number so it never goes through float64.
+	VariableTypeDecimal
+	// VariableTypeBytes is a []byte decoded from a base64 string.
+	VariableTypeBytes
+)
+
+var variableTypeNames = map[pbEndpoint.VariableType]string{
+	VariableTypeArray:    "array",
+	VariableTypeDatetime: "datetime",
+	VariableTypeDuration: "duration",
+	VariableTypeDecimal:  "decimal",
+	VariableTypeBytes:    "bytes",
+}
+
+func variableTypeName(varType pbEndpoint.VariableType) string {
+	if name, ok := variableTypeNames[varType]; ok {
+		return name
+	}
+	return varType.String()
+}
+
+// castError reports a value that can't be parsed to the target type. Only scalar values are formatted, a map or
+// a struct of the context data can hold secrets such as the request headers.
+func castError(value any, target string) error {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Errorf("unable to cast %#v of type %T to %s", value, value, target)
+	}
+	return fmt.Errorf("unable to cast a value of type %T to %s", value, target)
+}
+
+func (v *Variable) parseArray(value any, opt *options) ([]any, error) {
+	var elements []any
+
+	switch typed := value.(type) {
+	case string:
+		trimmed := strings.TrimSpace(typed)
+		if strings.HasPrefix(trimmed, "[") {
+			if err := json.Unmarshal([]byte(trimmed), &elements); err != nil {
+				return nil, castError(value, "[]"+variableTypeName(opt.elementType))
+			}
+			break
+		}
+
+		if trimmed == "" {
+			return []any{}, nil
+		}
+		for _, element := range strings.Split(trimmed, ",") {
+			elements = append(elements, strings.TrimSpace(element))
+		}
+
+	default:
+		reflectValue := reflect.ValueOf(value)
+		if !isListValue(reflectValue) {
+			return nil, castError(value, "[]"+variableTypeName(opt.elementType))
+		}
+
+		for i := 0; i < reflectValue.Len(); i++ {
+			elements = append(elements, reflectValue.Index(i).Interface())
+		}
+	}
+
+	// nested arrays keep their elements as is
+	elementOpt := *opt
+	elementOpt.elementType = pbEndpoint.VariableType_VARIABLE_TYPE_UNSPECIFIED
+
+	result := make([]any, 0, len(elements))
+	for i, element := range elements {
+		parsed, err := v.parseValueByType(element, opt.elementType, &elementOpt)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		result = append(result, parsed)
+	}
+
+	return result, nil
+}
+
+func parseDatetime(value any, layout string) (time.Time, error) {
+	if layout == "" {
+		return castValue(value, "datetime", cast.ToTimeE)
+	}
+
+	switch typed := value.(type) {
+	case time.Time:
+		return typed, nil
+	case string:
+		result, err := time.Parse(funcTimeLayout(layout), strings.TrimSpace(typed))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to parse %q with layout %q to datetime", typed, layout)
+		}
+		return result, nil
+	}
+
+	return castValue(value, "datetime", cast.ToTimeE)
+}
+
+// castValue casts a value with a cast function, its error is replaced by castError.
+func castValue[T any](value any, target string, castFunc func(any) (T, error)) (T, error) {
+	result, err := castFunc(value)
+	if err != nil {
+		return result, castError(value, target)
+	}
+	return result, nil
+}
+
+// decimalRegex matches the sign, the integer digits, the fraction digits and the exponent of a decimal. The
+// digits can be empty on one side of the point, ex: "1." or ".5", the number is normalized to a JSON number.
+var decimalRegex = regexp.MustCompile(`^([+-]?)(\d*)(?:\.(\d*))?(?:[eE]([+-]?\d+))?$`)
+
+// maxDecimalExponent bounds the exponent of a decimal, it's expanded to a plain decimal of about as many digits.
+const maxDecimalExponent = 1000
+
+// ErrDecimalRange is returned for a decimal with an exponent out of ±maxDecimalExponent.
+var ErrDecimalRange = errors.New("decimal exponent out of range")
+
+func parseDecimal(value any) (json.Number, error) {
+	var text string
+
+	switch typed := value.(type) {
+	case json.Number:
+		text = typed.String()
+	case string:
+		text = strings.TrimSpace(typed)
+	case float32:
+		text = strconv.FormatFloat(float64(typed), 'f', -1, 32)
+	case float64:
+		text = strconv.FormatFloat(typed, 'f', -1, 64)
+	default:
+		if !isInteger(value) {
+			return "", castError(value, "decimal")
+		}
+		text = cast.ToString(value)
+	}
+
+	match := decimalRegex.FindStringSubmatch(text)
+	if match == nil || match[2]+match[3] == "" {
+		return "", castError(value, "decimal")
+	}
+
+	// keep the digits unless the number uses an exponent, which is expanded to a plain decimal
+	sign, integer, fraction := match[1], match[2], match[3]
+	if match[4] == "" {
+		return json.Number(decimalString(sign, integer, fraction)), nil
+	}
+
+	exponent, err := strconv.Atoi(match[4])
+	if err != nil || exponent < -maxDecimalExponent || exponent > maxDecimalExponent {
+		return "", fmt.Errorf("%w: %q, the limit is ±%d", ErrDecimalRange, text, maxDecimalExponent)
+	}
+
+	rat, ok := new(big.Rat).SetString(decimalString(sign, integer, fraction) + "e" + match[4])
+	if !ok {
+		return "", castError(value, "decimal")
+	}
+
+	// digits of the fraction once the exponent is applied, the expansion is exact
+	return json.Number(ratToDecimalString(rat, len(fraction)-exponent)), nil
+}
+
+// decimalString formats the digits of a decimal as a JSON number: no plus sign, no leading zeros and no point
+// without fraction digits, ex: "+007." is "7" and ".50" is "0.50".
+func decimalString(sign, integer, fraction string) string {
+	if sign == "+" {
+		sign = ""
+	}
+
+	integer = strings.TrimLeft(integer, "0")
+	if integer == "" {
+		integer = "0"
+	}
+
+	if fraction == "" {
+		return sign + integer
+	}
+	return sign + integer + "." + fraction
+}
+
+// ratToDecimalString formats a decimal with at most scale digits after the point, trailing zeros removed.
+func ratToDecimalString(rat *big.Rat, scale int) string {
+	if rat.IsInt() || scale <= 0 {
+		return rat.RatString()
+	}
+
+	return strings.TrimRight(rat.FloatString(scale), "0")
+}
+
+func parseBytes(value any) ([]byte, error) {
+	switch typed := value.(type) {
+	case []byte:
+		return typed, nil
+	case string:
+		trimmed := strings.TrimSpace(typed)
+		for _, encoding := range []*base64.Encoding{
+			base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding,
+		} {
+			if decoded, err := encoding.DecodeString(trimmed); err == nil {
+				return decoded, nil
+			}
+		}
+	}
+
+	return nil, castError(value, "bytes")
+}
@@ -0,0 +1,215 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	entityContext "github.com/ideagate/core/model/entity/context"
+	pbEndpoint "github.com/ideagate/model/gen-go/core/endpoint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Variable Type", func() {
+	mockStepId := "mockStepId"
+
+	mockCtxData := &entityContext.ContextData{
+		Req: entityContext.ContextRequestData{
+			Query: map[string]any{
+				"ids":      "1, 2, 3",
+				"date":     "2024-01-02",
+				"datetime": "2024-01-02T03:04:05Z",
+				"timeout":  "1m30s",
+				"amount":   "12345678901234567.89",
+				"file":     "aGVsbG8=",
+			},
+			Json: map[string]any{
+				"ids":    []any{1.0, 2.0, 3.0},
+				"tags":   `["a","b"]`,
+				"amount": json.Number("0.1"),
+				"price":  19.99,
+			},
+		},
+		Step: map[string]entityContext.ContextStepData{
+			mockStepId: {},
+		},
+	}
+
+	runTest := func(variable *Variable, opts []Option, wantResult any, wantErr bool) {
+		got, err := variable.GetValue(mockStepId, mockCtxData, opts...)
+
+		if wantResult == nil {
+			Expect(got).To(BeNil())
+		} else {
+			Expect(got).To(Equal(wantResult))
+		}
+
+		if wantErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).To(BeNil())
+		}
+	}
+
+	DescribeTable("Array", runTest,
+		Entry("comma separated with element type", &Variable{
+			Value: "{{.Req.Query.ids}}",
+			Type:  VariableTypeArray,
+		}, []Option{WithElementType(pbEndpoint.VariableType_VARIABLE_TYPE_INT)}, []any{int64(1), int64(2), int64(3)}, false),
+		Entry("native slice with element type", &Variable{
+			Value: "$.Req.Json.ids",
+			Type:  VariableTypeArray,
+		}, []Option{WithSyntax(SyntaxPath), WithElementType(pbEndpoint.VariableType_VARIABLE_TYPE_STRING)}, []any{"1", "2", "3"}, false),
+		Entry("json array without element type", &Variable{
+			Value: "{{.Req.Json.tags}}",
+			Type:  VariableTypeArray,
+		}, nil, []any{"a", "b"}, false),
+		Entry("using default", &Variable{
+			Value:    "{{.Req.Query.unknown}}",
+			Type:     VariableTypeArray,
+			Required: true,
+			Default:  "[true, false]",
+		}, []Option{WithElementType(pbEndpoint.VariableType_VARIABLE_TYPE_BOOL)}, []any{true, false}, false),
+		Entry("invalid element", &Variable{
+			Value: "a,b",
+			Type:  VariableTypeArray,
+		}, []Option{WithElementType(pbEndpoint.VariableType_VARIABLE_TYPE_INT)}, nil, true),
+		Entry("invalid value", &Variable{
+			Value: "{{.Req.Json.price}}",
+			Type:  VariableTypeArray,
+		}, nil, nil, true),
+	)
+
+	DescribeTable("Datetime", runTest,
+		Entry("RFC3339 without layout", &Variable{
+			Value: "{{.Req.Query.datetime}}",
+			Type:  VariableTypeDatetime,
+		}, nil, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), false),
+		Entry("custom layout", &Variable{
+			Value: "{{.Req.Query.date}}",
+			Type:  VariableTypeDatetime,
+		}, []Option{WithTimeLayout("2006-01-02")}, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), false),
+		Entry("named layout", &Variable{
+			Value: "{{.Req.Query.datetime}}",
+			Type:  VariableTypeDatetime,
+		}, []Option{WithTimeLayout("RFC3339")}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), false),
+		Entry("layout mismatch", &Variable{
+			Value: "{{.Req.Query.date}}",
+			Type:  VariableTypeDatetime,
+		}, []Option{WithTimeLayout("RFC3339")}, nil, true),
+	)
+
+	DescribeTable("Duration", runTest,
+		Entry("string", &Variable{
+			Value: "{{.Req.Query.timeout}}",
+			Type:  VariableTypeDuration,
+		}, nil, 90*time.Second, false),
+		Entry("using default", &Variable{
+			Value:    "{{.Req.Query.unknown}}",
+			Type:     VariableTypeDuration,
+			Required: true,
+			Default:  "5s",
+		}, nil, 5*time.Second, false),
+		Entry("invalid", &Variable{
+			Value: "forever",
+			Type:  VariableTypeDuration,
+		}, nil, nil, true),
+	)
+
+	DescribeTable("Decimal", runTest,
+		Entry("string keeps precision", &Variable{
+			Value: "{{.Req.Query.amount}}",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("12345678901234567.89"), false),
+		Entry("json number", &Variable{
+			Value: "$.Req.Json.amount",
+			Type:  VariableTypeDecimal,
+		}, []Option{WithSyntax(SyntaxPath)}, json.Number("0.1"), false),
+		Entry("float", &Variable{
+			Value: "$.Req.Json.price",
+			Type:  VariableTypeDecimal,
+		}, []Option{WithSyntax(SyntaxPath)}, json.Number("19.99"), false),
+		Entry("exponent", &Variable{
+			Value: "1.5e3",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("1500"), false),
+		Entry("exponent at the limit keeps every digit", &Variable{
+			Value: "-1.25e-1000",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("-0."+strings.Repeat("0", 999)+"125"), false),
+		Entry("small exponent", &Variable{
+			Value: "12.50e-3",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("0.0125"), false),
+		Entry("exponent out of range", &Variable{
+			Value: "1e100000",
+			Type:  VariableTypeDecimal,
+		}, nil, nil, true),
+		Entry("trailing point", &Variable{
+			Value: "1.",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("1"), false),
+		Entry("leading point", &Variable{
+			Value: ".5",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("0.5"), false),
+		Entry("plus sign and leading point", &Variable{
+			Value: "+.5",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("0.5"), false),
+		Entry("leading zeros", &Variable{
+			Value: "007",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("7"), false),
+		Entry("leading zeros keep the fraction", &Variable{
+			Value: "-000.50",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("-0.50"), false),
+		Entry("leading point with exponent", &Variable{
+			Value: ".5e1",
+			Type:  VariableTypeDecimal,
+		}, nil, json.Number("5"), false),
+		Entry("point only", &Variable{
+			Value: ".",
+			Type:  VariableTypeDecimal,
+		}, nil, nil, true),
+		Entry("invalid", &Variable{
+			Value: "12,50",
+			Type:  VariableTypeDecimal,
+		}, nil, nil, true),
+		Entry("fraction is not a decimal", &Variable{
+			Value: "1/3",
+			Type:  VariableTypeDecimal,
+		}, nil, nil, true),
+	)
+
+	It("Decimal - marshals as a JSON number", func() {
+		for _, value := range []string{"1.", ".5", "+.5", "007", "-0.0", "+1.5e3", "00.25e-1"} {
+			got, err := (&Variable{Value: value, Type: VariableTypeDecimal}).GetValue(mockStepId, mockCtxData)
+			Expect(err).To(BeNil())
+
+			body, err := json.Marshal(map[string]any{"amount": got})
+			Expect(err).To(BeNil(), value)
+			Expect(json.Valid(body)).To(BeTrue())
+		}
+	})
+
+	It("Decimal - exponent out of range", func() {
+		for _, value := range []string{"1e-1001", "1e100000"} {
+			_, err := (&Variable{Value: value, Type: VariableTypeDecimal}).GetValue(mockStepId, mockCtxData)
+			Expect(err).To(MatchError(ErrDecimalRange))
+		}
+	})
+
+	DescribeTable("Bytes", runTest,
+		Entry("base64", &Variable{
+			Value: "{{.Req.Query.file}}",
+			Type:  VariableTypeBytes,
+		}, nil, []byte("hello"), false),
+		Entry("invalid", &Variable{
+			Value: "not base64!",
+			Type:  VariableTypeBytes,
+		}, nil, nil, true),
+	)
+})
@@ -0,0 +1,341 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MergePolicy decides the value kept when several branches write the same field of a step or global variable
+// with different values.
+type MergePolicy int
+
+const (
+	// MergePolicyError fails the merge with a *MergeConflictError, nothing is merged.
+	MergePolicyError MergePolicy = iota
+	// MergePolicyFirstWins keeps the value of the first branch, in the order given to Merge, or the value of the
+	// context data when it wrote the field after the fork.
+	MergePolicyFirstWins
+	// MergePolicyLastWins keeps the value of the last branch, in the order given to Merge.
+	MergePolicyLastWins
+)
+
+var (
+	ErrMergeConflict = errors.New("context data merge conflict")
+	ErrNotBranch     = errors.New("context data is not a branch of the merged context data")
+)
+
+// MergeConflict is a field of a step or a global variable written with different values by several branches, or
+// by a branch and by the merged context data after the fork.
+type MergeConflict struct {
+	Path     string // Step.<StepId>.<Field> or Global.<Key>, ex: Step.auth.Out
+	Parent   bool   // the merged context data wrote the path after the fork
+	Branches []int  // indexes of the branches writing the path
+}
+
+// MergeConflictError is returned by a merge with MergePolicyError, it matches ErrMergeConflict.
+type MergeConflictError struct {
+	Conflicts []MergeConflict // sorted by path
+}
+
+func (e *MergeConflictError) Error() string {
+	paths := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		writers := fmt.Sprintf("branches %v", conflict.Branches)
+		if conflict.Parent {
+			writers = "parent, " + writers
+		}
+		paths[i] = fmt.Sprintf("%s (%s)", conflict.Path, writers)
+	}
+	return fmt.Sprintf("%s: %s", ErrMergeConflict, strings.Join(paths, ", "))
+}
+
+func (e *MergeConflictError) Unwrap() error {
+	return ErrMergeConflict
+}
+
+// Fork returns a branch of the context data, ex: for steps running in parallel after a condition. A branch reads
+// the data of the context data and keeps its own writes, steps and global variables, until Merge. The fork keeps
+// a view of the context data to detect its later writes, and a step is copied on its first write. The writes are
+// checked against the budget of the execution with the data of the parents, see SetBudget.
+func (ctxData *ContextData) Fork() *ContextData {
+	base := ctxData.View()
+
+	ctxData.RLock()
+	defer ctxData.RUnlock()
+
+	return &ContextData{
+		Frame:       ctxData.Frame,
+		parent:      ctxData,
+		isBranch:    true,
+		base:        base,
+		observer:    ctxData.observer,
+		executionId: ctxData.executionId,
+	}
+}
+
+// Merge writes the fields of the steps and the global variables written by the branches into the context data,
+// ex: at the join step. The fields a branch didn't write keep the value of the context data, also when it was
+// written after the fork. Branches are merged in the given order, after the context data for MergePolicyFirstWins:
+// a field written with different values by several branches, or by a branch and by the context data after the
+// fork, is a conflict. The same values are not a conflict, nor is the execution metadata of a step, ex: the start
+// time of a step run by several branches, picked by the policy.
+//
+// The merged values are checked against the budget of the context data. A merge failing with a conflict or with
+// the *BudgetError of a value is not merged at all.
+func (ctxData *ContextData) Merge(policy MergePolicy, branches ...*ContextData) error {
+	writes := make(map[sizeKey][]branchValue)
+	for i, branch := range branches {
+		if branch.parent != ctxData || !branch.isBranch {
+			return fmt.Errorf("branch %d: %w", i, ErrNotBranch)
+		}
+
+		for key, value := range branch.writtenValues() {
+			writes[key] = append(writes[key], branchValue{branch: i, value: value, base: branch.base.fieldValue(key)})
+		}
+	}
+
+	var (
+		keys      = sortedSizeKeys(writes)
+		values    = make(map[sizeKey]any, len(keys))
+		conflicts []MergeConflict
+	)
+	for _, key := range keys {
+		current := ctxData.currentValue(key)
+
+		conflict, ok := mergeConflict(key, current, writes[key])
+		if ok {
+			conflicts = append(conflicts, conflict)
+		}
+
+		if ok && conflict.Parent && policy == MergePolicyFirstWins {
+			continue // the context data keeps its value
+		}
+		values[key] = mergedValue(policy, writes[key])
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+
+	if len(conflicts) > 0 && policy == MergePolicyError {
+		return &MergeConflictError{Conflicts: conflicts}
+	}
+
+	// the global variables are the ones SetGlobal writes, ex: of the execution when merging into an iteration
+	root := ctxData.root()
+	restoreGlobals, err := root.mergeValues(keys, values, func(key sizeKey) bool { return key.stepId == "" })
+	if err != nil {
+		return err
+	}
+	if _, err = ctxData.mergeValues(keys, values, func(key sizeKey) bool { return key.stepId != "" }); err != nil {
+		restoreGlobals()
+		return err
+	}
+
+	return nil
+}
+
+// mergeValues sets the merged values of the keys, in order, under the write lock. When a value doesn't fit the
+// budget, nothing is set and the error is returned. Otherwise restore undoes the merge.
+func (ctxData *ContextData) mergeValues(keys []sizeKey, values map[sizeKey]any, filter func(key sizeKey) bool) (restore func(), err error) {
+	ctxData.Lock()
+	defer ctxData.unlockAndFlush()
+
+	restoreLocked := ctxData.saveLocked()
+	restore = func() {
+		ctxData.Lock()
+		restoreLocked()
+		ctxData.Unlock()
+	}
+
+	for _, key := range keys {
+		value, ok := values[key]
+		if !ok || !filter(key) {
+			continue
+		}
+
+		if key.stepId == "" {
+			err = ctxData.setGlobalLocked(strings.TrimPrefix(key.field, sizeFieldGlobal), value)
+		} else {
+			err = ctxData.setStepFieldLocked(key.stepId, key.field, value)
+		}
+		if err != nil {
+			restoreLocked()
+			return nil, err
+		}
+	}
+
+	return restore, nil
+}
+
+// setStepFieldLocked sets a field of the step data fitting the budget.
+func (ctxData *ContextData) setStepFieldLocked(stepId, field string, value any) error {
+	switch field {
+	case sizeFieldStatusCode:
+		statusCode, _ := value.(int)
+		return ctxData.setStepLocked(stepId, field, sizedStatusCode(statusCode), func(stepData *ContextStepData, _ any) {
+			stepData.Data.StatusCode = statusCode
+		})
+	case sizeFieldMeta:
+		meta, _ := value.(ContextStepMeta)
+		return ctxData.setStepMetaLocked(stepId, meta)
+	}
+
+	return ctxData.setStepLocked(stepId, field, value, func(stepData *ContextStepData, value any) {
+		stepData.setFieldValue(field, value)
+	})
+}
+
+// saveLocked returns a function restoring the steps, the global variables, the sizes, the written fields and the
+// queued changes of the context data, ex: when a merge fails. Both must be called with the write lock.
+func (ctxData *ContextData) saveLocked() (restore func()) {
+	ctxData.initSizes()
+
+	var (
+		step      = maps.Clone(ctxData.Step)
+		global    = maps.Clone(ctxData.Global)
+		sizes     = maps.Clone(ctxData.sizes)
+		totalSize = ctxData.totalSize
+		written   = maps.Clone(ctxData.written)
+		changes   = len(ctxData.changes)
+	)
+
+	return func() {
+		ctxData.Step, ctxData.Global = step, global
+		ctxData.sizes, ctxData.totalSize = sizes, totalSize
+		ctxData.written = written
+		ctxData.changes = ctxData.changes[:changes]
+	}
+}
+
+// recordWrite records a field of a step or a global variable written by a branch. It must be called with the
+// write lock.
+func (ctxData *ContextData) recordWrite(key sizeKey) {
+	if !ctxData.isBranch || (key.stepId == "" && !strings.HasPrefix(key.field, sizeFieldGlobal)) {
+		return
+	}
+
+	if ctxData.written == nil {
+		ctxData.written = make(map[sizeKey]struct{})
+	}
+	ctxData.written[key] = struct{}{}
+}
+
+// writtenValues returns a deep copy of the values of the fields written by the branch.
+func (ctxData *ContextData) writtenValues() map[sizeKey]any {
+	ctxData.RLock()
+	defer ctxData.RUnlock()
+
+	values := make(map[sizeKey]any, len(ctxData.written))
+	for key := range ctxData.written {
+		values[key] = deepCopy(ctxData.fieldValue(key))
+	}
+	return values
+}
+
+// currentValue returns a deep copy of the value of a field of a step or of a global variable, read from the
+// context data or its parents.
+func (ctxData *ContextData) currentValue(key sizeKey) any {
+	if key.stepId == "" {
+		value, _ := ctxData.GetGlobal(strings.TrimPrefix(key.field, sizeFieldGlobal))
+		return value
+	}
+
+	stepData, _ := ctxData.lookupStep(key.stepId)
+	return stepData.fieldValue(key.field)
+}
+
+// fieldValue returns the value of a field of a step or of a global variable of the context data itself.
+func (ctxData *ContextData) fieldValue(key sizeKey) any {
+	if key.stepId == "" {
+		return ctxData.Global[strings.TrimPrefix(key.field, sizeFieldGlobal)]
+	}
+	return ctxData.Step[key.stepId].fieldValue(key.field)
+}
+
+func (stepData ContextStepData) fieldValue(field string) any {
+	switch field {
+	case sizeFieldVar:
+		return stepData.Var
+	case sizeFieldBody:
+		return stepData.Data.Body
+	case sizeFieldOut:
+		return stepData.Out
+	case sizeFieldStatusCode:
+		return stepData.Data.StatusCode
+	case sizeFieldMeta:
+		return stepData.Meta
+	}
+	return nil
+}
+
+// setFieldValue sets the data of a step set with setStep: variables, body or output.
+func (stepData *ContextStepData) setFieldValue(field string, value any) {
+	switch field {
+	case sizeFieldVar:
+		stepData.Var, _ = value.(map[string]any)
+	case sizeFieldBody:
+		stepData.Data.Body = value
+	case sizeFieldOut:
+		stepData.Out, _ = value.(map[string]any)
+	}
+}
+
+// branchValue is a value written by a branch and the value of the field at the fork, the values of a path are in
+// the order of the branches.
+type branchValue struct {
+	branch int
+	value  any
+	base   any
+}
+
+func mergeConflict(key sizeKey, current any, values []branchValue) (MergeConflict, bool) {
+	if key.field == sizeFieldMeta {
+		return MergeConflict{}, false
+	}
+
+	conflict := MergeConflict{Path: key.field}
+	if key.stepId != "" {
+		conflict.Path = "Step." + key.stepId + "." + key.field
+	}
+
+	isConflict := false
+	for _, value := range values {
+		conflict.Branches = append(conflict.Branches, value.branch)
+
+		if !reflect.DeepEqual(values[0].value, value.value) {
+			isConflict = true
+		}
+		// the context data wrote another value after the fork of the branch
+		if !reflect.DeepEqual(value.base, current) && !reflect.DeepEqual(value.value, current) {
+			conflict.Parent, isConflict = true, true
+		}
+	}
+
+	if !isConflict {
+		return MergeConflict{}, false
+	}
+	return conflict, true
+}
+
+func mergedValue(policy MergePolicy, values []branchValue) any {
+	if policy == MergePolicyLastWins {
+		return values[len(values)-1].value
+	}
+	return values[0].value
+}
+
+func sortedSizeKeys[T any](m map[sizeKey]T) []sizeKey {
+	keys := make([]sizeKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stepId != keys[j].stepId {
+			return keys[i].stepId < keys[j].stepId
+		}
+		return keys[i].field < keys[j].field
+	})
+	return keys
+}
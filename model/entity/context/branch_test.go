@@ -0,0 +1,250 @@
+package context
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBranchContextData() *ContextData {
+	ctxData := &ContextData{}
+	ctxData.SetRequestMethod("GET")
+	ctxData.SetStepDataBody("start", []any{"a"})
+	ctxData.SetStepStatusCode("start", 200)
+	ctxData.SetGlobal("user_id", 1)
+	return ctxData
+}
+
+func TestContextData_Fork(t *testing.T) {
+	var (
+		ctxData = newBranchContextData()
+		left    = ctxData.Fork()
+		right   = ctxData.Fork()
+		wg      sync.WaitGroup
+	)
+
+	// branches run in parallel
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		left.SetStepOutput("left", map[string]any{"value": "L"})
+		left.SetGlobal("side", "left")
+	}()
+	go func() {
+		defer wg.Done()
+		right.SetStepOutput("right", map[string]any{"value": "R"})
+		right.SetStepStatusCode("start", 201) // copied on write
+	}()
+	wg.Wait()
+
+	// a branch reads the data of the fork and its own writes
+	leftSnapshot := left.Snapshot()
+	assert.Equal(t, "GET", leftSnapshot.Req.Method)
+	assert.Equal(t, []any{"a"}, leftSnapshot.Step["start"].Data.Body)
+	assert.Equal(t, "L", leftSnapshot.Step["left"].Out["value"])
+	assert.Equal(t, map[string]any{"user_id": 1, "side": "left"}, leftSnapshot.Global)
+
+	// branches can't see each other's writes before the join
+	assert.NotContains(t, leftSnapshot.Step, "right")
+	assert.Equal(t, 200, left.GetStep("start").Data.StatusCode)
+	_, ok := right.GetGlobal("side")
+	assert.False(t, ok)
+	assert.Equal(t, ContextStepData{}, right.GetStep("left"))
+
+	// nor the context data they are forked from
+	assert.NotContains(t, ctxData.Snapshot().Step, "left")
+	assert.Equal(t, 200, ctxData.GetStep("start").Data.StatusCode)
+	_, ok = ctxData.GetGlobal("side")
+	assert.False(t, ok)
+
+	// the step copied on write keeps the data of the fork
+	assert.Equal(t, []any{"a"}, right.GetStep("start").Data.Body)
+	assert.Equal(t, 201, right.GetStep("start").Data.StatusCode)
+
+	assert.NoError(t, ctxData.Merge(MergePolicyError, left, right))
+
+	snapshot := ctxData.Snapshot()
+	assert.Equal(t, "L", snapshot.Step["left"].Out["value"])
+	assert.Equal(t, "R", snapshot.Step["right"].Out["value"])
+	assert.Equal(t, 201, snapshot.Step["start"].Data.StatusCode)
+	assert.Equal(t, []any{"a"}, snapshot.Step["start"].Data.Body)
+	assert.Equal(t, map[string]any{"user_id": 1, "side": "left"}, snapshot.Global)
+}
+
+func TestContextData_Fork_budget(t *testing.T) {
+	ctxData := newBranchContextData()
+	ctxData.SetBudget(Budget{MaxTotalSize: 200})
+	branch := ctxData.Fork()
+
+	// a value over the budget of the execution is not set by a branch
+	big := strings.Repeat("x", 1<<20)
+	assert.ErrorIs(t, branch.SetStepDataBody("big", big), ErrBudgetExceeded)
+	assert.ErrorIs(t, branch.SetGlobal("big", big), ErrBudgetExceeded)
+	assert.ErrorIs(t, branch.NewIteration("foreach", 0, nil).SetGlobal("big", big), ErrBudgetExceeded)
+	assert.Nil(t, branch.GetStep("big").Data.Body)
+	_, ok := branch.GetGlobal("big")
+	assert.False(t, ok)
+
+	// the data of the context data counts in the total
+	free := 200 - ctxData.Size()
+	assert.ErrorIs(t, branch.SetGlobal("side", strings.Repeat("x", int(free))), ErrBudgetExceeded)
+	assert.NoError(t, branch.SetGlobal("side", strings.Repeat("x", int(free)-sizeString)))
+	assert.NoError(t, ctxData.Merge(MergePolicyError, branch))
+	assert.Equal(t, int64(200), ctxData.Size())
+}
+
+func TestContextData_Merge(t *testing.T) {
+	newBranches := func(ctxData *ContextData) []*ContextData {
+		first, second, third := ctxData.Fork(), ctxData.Fork(), ctxData.Fork()
+		first.SetStepOutput("shared", map[string]any{"value": 1})
+		second.SetStepOutput("shared", map[string]any{"value": 2})
+		third.SetStepOutput("shared", map[string]any{"value": 3})
+		first.SetGlobal("same", "value")
+		third.SetGlobal("same", "value")
+		first.SetGlobal("status", "first")
+		second.SetGlobal("status", "second")
+		return []*ContextData{first, second, third}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		ctxData := newBranchContextData()
+
+		err := ctxData.Merge(MergePolicyError, newBranches(ctxData)...)
+		assert.ErrorIs(t, err, ErrMergeConflict)
+
+		var conflictErr *MergeConflictError
+		assert.True(t, errors.As(err, &conflictErr))
+		assert.Equal(t, []MergeConflict{
+			{Path: "Global.status", Branches: []int{0, 1}},
+			{Path: "Step.shared.Out", Branches: []int{0, 1, 2}},
+		}, conflictErr.Conflicts)
+		assert.Equal(t, "context data merge conflict: Global.status (branches [0 1]), Step.shared.Out (branches [0 1 2])", err.Error())
+
+		// nothing is merged
+		assert.NotContains(t, ctxData.Snapshot().Step, "shared")
+		_, ok := ctxData.GetGlobal("same")
+		assert.False(t, ok)
+	})
+
+	t.Run("first wins", func(t *testing.T) {
+		ctxData := newBranchContextData()
+
+		assert.NoError(t, ctxData.Merge(MergePolicyFirstWins, newBranches(ctxData)...))
+		assert.Equal(t, 1, ctxData.GetStep("shared").Out["value"])
+		assert.Equal(t, map[string]any{"user_id": 1, "same": "value", "status": "first"}, ctxData.Snapshot().Global)
+	})
+
+	t.Run("last wins", func(t *testing.T) {
+		ctxData := newBranchContextData()
+
+		assert.NoError(t, ctxData.Merge(MergePolicyLastWins, newBranches(ctxData)...))
+		assert.Equal(t, 3, ctxData.GetStep("shared").Out["value"])
+		assert.Equal(t, map[string]any{"user_id": 1, "same": "value", "status": "second"}, ctxData.Snapshot().Global)
+		assert.Equal(t, ctxData.Snapshot().Size(), ctxData.Size())
+	})
+
+	t.Run("fields written after the fork", func(t *testing.T) {
+		ctxData := newBranchContextData()
+		left, right := ctxData.Fork(), ctxData.Fork()
+
+		// the context data writes after the fork, the branches write other fields of the same step
+		assert.NoError(t, ctxData.SetStepOutput("start", map[string]any{"value": "parent"}))
+		left.SetStepStatusCode("start", 201)
+		assert.NoError(t, right.SetStepVariable("start", map[string]any{"id": 1}))
+
+		// the execution metadata is not a conflict
+		left.SetStepStartTime("start", time.Now())
+		right.SetStepStartTime("start", time.Now().Add(time.Second))
+
+		assert.NoError(t, ctxData.Merge(MergePolicyError, left, right))
+
+		stepData := ctxData.GetStep("start")
+		assert.Equal(t, map[string]any{"value": "parent"}, stepData.Out)
+		assert.Equal(t, 201, stepData.Data.StatusCode)
+		assert.Equal(t, map[string]any{"id": 1}, stepData.Var)
+		assert.Equal(t, []any{"a"}, stepData.Data.Body)
+		assert.False(t, stepData.Meta.StartTime.IsZero())
+	})
+
+	t.Run("conflict with the context data", func(t *testing.T) {
+		newBranch := func(ctxData *ContextData) *ContextData {
+			branch := ctxData.Fork()
+			ctxData.SetStepStatusCode("start", 500)
+			branch.SetStepStatusCode("start", 201)
+			assert.NoError(t, ctxData.SetGlobal("user_id", 2))
+			assert.NoError(t, branch.SetGlobal("user_id", 2)) // same value
+			return branch
+		}
+
+		ctxData := newBranchContextData()
+		err := ctxData.Merge(MergePolicyError, newBranch(ctxData))
+
+		var conflictErr *MergeConflictError
+		assert.True(t, errors.As(err, &conflictErr))
+		assert.Equal(t, []MergeConflict{{Path: "Step.start.Data.StatusCode", Parent: true, Branches: []int{0}}}, conflictErr.Conflicts)
+		assert.Equal(t, "context data merge conflict: Step.start.Data.StatusCode (parent, branches [0])", err.Error())
+
+		// the context data wrote first
+		ctxData = newBranchContextData()
+		assert.NoError(t, ctxData.Merge(MergePolicyFirstWins, newBranch(ctxData)))
+		assert.Equal(t, 500, ctxData.GetStep("start").Data.StatusCode)
+
+		ctxData = newBranchContextData()
+		assert.NoError(t, ctxData.Merge(MergePolicyLastWins, newBranch(ctxData)))
+		assert.Equal(t, 201, ctxData.GetStep("start").Data.StatusCode)
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		ctxData := newBranchContextData()
+		branch := ctxData.Fork()
+		assert.NoError(t, branch.SetStepOutput("big", map[string]any{"value": strings.Repeat("x", 100)}))
+		assert.NoError(t, branch.SetGlobal("side", "left"))
+
+		// nothing is merged
+		ctxData.SetBudget(Budget{MaxStepSize: 50})
+		size := ctxData.Size()
+		assert.ErrorIs(t, ctxData.Merge(MergePolicyError, branch), ErrBudgetExceeded)
+		assert.NotContains(t, ctxData.Snapshot().Step, "big")
+		_, ok := ctxData.GetGlobal("side")
+		assert.False(t, ok)
+		assert.Equal(t, size, ctxData.Size())
+
+		ctxData.SetBudget(Budget{MaxStepSize: 50, Policy: BudgetPolicyTruncate})
+		assert.NoError(t, ctxData.Merge(MergePolicyError, branch))
+		assert.True(t, ctxData.GetStep("big").Meta.Truncated)
+		assert.LessOrEqual(t, ctxData.StepSize("big"), int64(50))
+		assert.Equal(t, ctxData.Snapshot().Size(), ctxData.Size())
+	})
+
+	t.Run("not a branch", func(t *testing.T) {
+		ctxData := newBranchContextData()
+
+		err := ctxData.Merge(MergePolicyError, ctxData.NewIteration("foreach", 0, nil))
+		assert.ErrorIs(t, err, ErrNotBranch)
+
+		err = ctxData.Merge(MergePolicyError, newBranchContextData().Fork())
+		assert.ErrorIs(t, err, ErrNotBranch)
+	})
+}
+
+func TestContextData_ForkIteration(t *testing.T) {
+	ctxData := newBranchContextData()
+
+	// a branch of an iteration keeps the frame and iterations of a branch write the globals of the branch
+	iteration := ctxData.NewIteration("foreach", 2, "c")
+	branch := iteration.Fork()
+	assert.Equal(t, &ContextFrame{StepId: "foreach", Index: 2, Item: "c"}, branch.Snapshot().Frame)
+
+	inner := branch.NewIteration("inner", 0, "x")
+	assert.NoError(t, inner.SetGlobal("inner", true))
+	_, ok := ctxData.GetGlobal("inner")
+	assert.False(t, ok)
+
+	assert.NoError(t, iteration.Merge(MergePolicyError, branch))
+	value, _ := ctxData.GetGlobal("inner")
+	assert.Equal(t, true, value)
+}
@@ -0,0 +1,355 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CheckpointVersion is the version of the serialized context data. Restoring data written by a newer version
+// fails with ErrCheckpointVersion.
+const CheckpointVersion = 1
+
+var ErrCheckpointVersion = errors.New("unsupported context data version")
+
+// checkpointJSON is the JSON document of a checkpoint.
+type checkpointJSON struct {
+	Version int                        `json:"version"`
+	Req     ContextRequestData         `json:"req"`
+	Step    map[string]ContextStepData `json:"step,omitempty"`
+	Global  map[string]any             `json:"global,omitempty"`
+	Frame   *ContextFrame              `json:"frame,omitempty"`
+}
+
+// MarshalCheckpointJSON serializes the context data as versioned JSON, ex: to persist a running workflow after
+// each step. An iteration or a branch is serialized as the data it reads, with the data of its parents. Integers,
+// floats and json.Number values are restored with their type, see UnmarshalCheckpointJSON.
+func (ctxData *ContextData) MarshalCheckpointJSON() ([]byte, error) {
+	snapshot, err := ctxData.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := checkpointJSON{Version: CheckpointVersion}
+
+	if checkpoint.Req, err = snapshot.Req.transform(toJSONValue); err != nil {
+		return nil, err
+	}
+	if checkpoint.Step, err = transformSteps(snapshot.Step, toJSONValue); err != nil {
+		return nil, err
+	}
+	if checkpoint.Global, err = transformMap(snapshot.Global, toJSONValue); err != nil {
+		return nil, fmt.Errorf("global %w", err)
+	}
+	if checkpoint.Frame, err = snapshot.Frame.transform(toJSONValue); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(checkpoint)
+}
+
+// UnmarshalCheckpointJSON restores context data written by MarshalCheckpointJSON. Integers are restored as
+// int64 (uint64 above the int64 range), floats as float64 and decimals that don't fit a float64 as json.Number.
+// Maps and lists are restored as map[string]any and []any.
+func UnmarshalCheckpointJSON(data []byte) (*ContextData, error) {
+	var checkpoint checkpointJSON
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid context data checkpoint: %w", err)
+	}
+
+	if checkpoint.Version < 1 || checkpoint.Version > CheckpointVersion {
+		return nil, fmt.Errorf("%w: %d", ErrCheckpointVersion, checkpoint.Version)
+	}
+
+	var (
+		ctxData = &ContextData{}
+		err     error
+	)
+	if ctxData.Req, err = checkpoint.Req.transform(fromJSONValue); err != nil {
+		return nil, err
+	}
+	if ctxData.Step, err = transformSteps(checkpoint.Step, fromJSONValue); err != nil {
+		return nil, err
+	}
+	if ctxData.Global, err = transformMap(checkpoint.Global, fromJSONValue); err != nil {
+		return nil, fmt.Errorf("global %w", err)
+	}
+	if ctxData.Frame, err = checkpoint.Frame.transform(fromJSONValue); err != nil {
+		return nil, err
+	}
+
+	return ctxData, nil
+}
+
+// normalized returns a snapshot of the view of the context data where every value is one of nil, bool, string,
+// int64, uint64, float64, json.Number, []byte, []any or map[string]any.
+func (ctxData *ContextData) normalized() (*ContextData, error) {
+	var (
+		view     = ctxData.View()
+		snapshot = &ContextData{}
+		err      error
+	)
+	if snapshot.Req, err = view.Req.transform(normalizeValue); err != nil {
+		return nil, err
+	}
+	if snapshot.Step, err = transformSteps(view.Step, normalizeValue); err != nil {
+		return nil, err
+	}
+	if snapshot.Global, err = transformMap(view.Global, normalizeValue); err != nil {
+		return nil, fmt.Errorf("global %w", err)
+	}
+	if snapshot.Frame, err = view.Frame.transform(normalizeValue); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (req ContextRequestData) transform(fn func(any) (any, error)) (ContextRequestData, error) {
+	var (
+		result = req
+		err    error
+	)
+
+	for _, field := range []*map[string]any{&result.Header, &result.Param, &result.Query, &result.Cookie, &result.Json, &result.Form} {
+		if *field, err = transformMap(*field, fn); err != nil {
+			return ContextRequestData{}, err
+		}
+	}
+
+	result.HeaderValues = copyHeaderValues(result.HeaderValues)
+	result.File = copyFiles(result.File)
+	result.RawBody = copyBytes(result.RawBody)
+
+	return result, nil
+}
+
+func (stepData ContextStepData) transform(fn func(any) (any, error)) (ContextStepData, error) {
+	var (
+		result = stepData
+		err    error
+	)
+
+	if result.Var, err = transformMap(result.Var, fn); err != nil {
+		return ContextStepData{}, err
+	}
+	if result.Data.Body, err = fn(result.Data.Body); err != nil {
+		return ContextStepData{}, err
+	}
+	if result.Data.Query, err = transformMap(result.Data.Query, fn); err != nil {
+		return ContextStepData{}, err
+	}
+	if result.Out, err = transformMap(result.Out, fn); err != nil {
+		return ContextStepData{}, err
+	}
+
+	return result, nil
+}
+
+func (frame *ContextFrame) transform(fn func(any) (any, error)) (*ContextFrame, error) {
+	if frame == nil {
+		return nil, nil
+	}
+
+	item, err := fn(frame.Item)
+	if err != nil {
+		return nil, fmt.Errorf("frame %s[%d]: %w", frame.StepId, frame.Index, err)
+	}
+	parent, err := frame.Parent.transform(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContextFrame{StepId: frame.StepId, Index: frame.Index, Item: item, Parent: parent}, nil
+}
+
+func transformSteps(steps map[string]ContextStepData, fn func(any) (any, error)) (map[string]ContextStepData, error) {
+	if steps == nil {
+		return nil, nil
+	}
+
+	result := make(map[string]ContextStepData, len(steps))
+	for stepId, stepData := range steps {
+		transformed, err := stepData.transform(fn)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", stepId, err)
+		}
+		result[stepId] = transformed
+	}
+
+	return result, nil
+}
+
+func transformMap(m map[string]any, fn func(any) (any, error)) (map[string]any, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	result := make(map[string]any, len(m))
+	for key, value := range m {
+		transformed, err := fn(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		result[key] = transformed
+	}
+
+	return result, nil
+}
+
+func transformList(list []any, fn func(any) (any, error)) ([]any, error) {
+	result := make([]any, len(list))
+	for i, item := range list {
+		transformed, err := fn(item)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		result[i] = transformed
+	}
+
+	return result, nil
+}
+
+// normalizeValue converts a value into the types a checkpoint can restore. Structs and other types are
+// converted through their JSON form.
+func normalizeValue(value any) (any, error) {
+	switch typed := value.(type) {
+	case nil, bool, string, int64, uint64, float64, json.Number:
+		return value, nil
+	case int:
+		return int64(typed), nil
+	case int8:
+		return int64(typed), nil
+	case int16:
+		return int64(typed), nil
+	case int32:
+		return int64(typed), nil
+	case uint:
+		return uint64(typed), nil
+	case uint8:
+		return uint64(typed), nil
+	case uint16:
+		return uint64(typed), nil
+	case uint32:
+		return uint64(typed), nil
+	case float32:
+		return float64(typed), nil
+	case []byte:
+		return append([]byte{}, typed...), nil
+	case map[string]any:
+		return transformMap(typed, normalizeValue)
+	case []any:
+		return transformList(typed, normalizeValue)
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if reflectValue.IsNil() {
+			return nil, nil
+		}
+		return normalizeValue(reflectValue.Elem().Interface())
+
+	case reflect.Map:
+		if reflectValue.Type().Key().Kind() == reflect.String {
+			result := make(map[string]any, reflectValue.Len())
+			iter := reflectValue.MapRange()
+			for iter.Next() {
+				item, err := normalizeValue(iter.Value().Interface())
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", iter.Key().String(), err)
+				}
+				result[iter.Key().String()] = item
+			}
+			return result, nil
+		}
+
+	case reflect.Slice, reflect.Array:
+		result := make([]any, reflectValue.Len())
+		for i := range result {
+			item, err := normalizeValue(reflectValue.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			result[i] = item
+		}
+		return result, nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("can't serialize %T: %w", value, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var decoded any
+	if err = decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	return fromJSONValue(decoded)
+}
+
+// toJSONValue writes floats so they are never read back as integers, ex: 10.0 instead of 10.
+func toJSONValue(value any) (any, error) {
+	switch typed := value.(type) {
+	case float64:
+		return json.Number(formatFloat(typed)), nil
+	case map[string]any:
+		return transformMap(typed, toJSONValue)
+	case []any:
+		return transformList(typed, toJSONValue)
+	}
+
+	return value, nil
+}
+
+func fromJSONValue(value any) (any, error) {
+	switch typed := value.(type) {
+	case json.Number:
+		return parseNumber(string(typed)), nil
+	case map[string]any:
+		return transformMap(typed, fromJSONValue)
+	case []any:
+		return transformList(typed, fromJSONValue)
+	}
+
+	return value, nil
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") { // n: NaN and Inf
+		s += ".0"
+	}
+	return s
+}
+
+// parseNumber restores a number written by toJSONValue or any other JSON number.
+func parseNumber(s string) any {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return u
+		}
+		return json.Number(s)
+	}
+
+	// a float64 is always written in its shortest form, anything else is a decimal
+	if f, err := strconv.ParseFloat(s, 64); err == nil && formatFloat(f) == s {
+		return f
+	}
+
+	return json.Number(s)
+}
@@ -0,0 +1,697 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The protobuf checkpoint is encoded with protowire following this schema, so other services can decode it
+// with generated code:
+//
+//	message Checkpoint {
+//	  uint32 version = 1;
+//	  Request req = 2;
+//	  map<string, Step> step = 3;
+//	  map<string, Value> global = 4;
+//	  Frame frame = 5;
+//	}
+//	message Request {
+//	  string method = 1;
+//	  string path = 2;
+//	  string host = 3;
+//	  string client_ip = 4;
+//	  map<string, Value> header = 5;
+//	  map<string, Value> param = 6;
+//	  map<string, Value> query = 7;
+//	  map<string, Value> cookie = 8;
+//	  map<string, Value> json = 9;
+//	  map<string, Value> form = 10;
+//	  map<string, Files> file = 11;
+//	  bytes raw_body = 12;
+//	  map<string, Strings> header_values = 13;
+//	}
+//	message Strings { repeated string values = 1; }
+//	message Files { repeated File files = 1; }
+//	message File { string filename = 1; string content_type = 2; int64 size = 3; }
+//	message Step { map<string, Value> var = 1; StepData data = 2; map<string, Value> out = 3; StepMeta meta = 4; }
+//	message StepData { Value body = 1; map<string, Value> query = 2; int64 status_code = 3; }
+//	message Frame { string step_id = 1; int64 index = 2; Value item = 3; Frame parent = 4; }
+//	message StepMeta {
+//	  int64 start_time = 1; // unix nanoseconds, 0 when not set
+//	  int64 end_time = 2;
+//	  int64 duration = 3; // nanoseconds
+//	  int64 attempts = 4;
+//	  string error = 5;
+//	  bool truncated = 6;
+//	}
+//	message Value {
+//	  oneof kind {
+//	    bool null = 1;
+//	    bool bool = 2;
+//	    int64 int = 3;
+//	    uint64 uint = 4;
+//	    double float = 5;
+//	    string string = 6;
+//	    bytes bytes = 7;
+//	    string decimal = 8;
+//	    List list = 9;
+//	    Map map = 10;
+//	  }
+//	}
+//	message List { repeated Value values = 1; }
+//	message Map { map<string, Value> fields = 1; }
+
+var errInvalidProto = errors.New("invalid context data checkpoint")
+
+// MarshalCheckpointProto serializes the context data as a versioned protobuf message, an iteration or a branch
+// with the data of its parents like MarshalCheckpointJSON. Unlike JSON, []byte values are kept as bytes.
+func (ctxData *ContextData) MarshalCheckpointProto() ([]byte, error) {
+	snapshot, err := ctxData.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, CheckpointVersion)
+	b = appendMessage(b, 2, appendProtoRequest(nil, snapshot.Req))
+
+	for _, stepId := range sortedKeys(snapshot.Step) {
+		b = appendMapEntry(b, 3, stepId, appendProtoStep(nil, snapshot.Step[stepId]))
+	}
+	b = appendValueMap(b, 4, snapshot.Global)
+	if snapshot.Frame != nil {
+		b = appendMessage(b, 5, appendProtoFrame(nil, snapshot.Frame))
+	}
+
+	return b, nil
+}
+
+// UnmarshalCheckpointProto restores context data written by MarshalCheckpointProto, values have the same types
+// as with UnmarshalCheckpointJSON.
+func UnmarshalCheckpointProto(data []byte) (*ContextData, error) {
+	var (
+		ctxData = &ContextData{}
+		version uint64
+	)
+
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			var n int
+			version, n = protowire.ConsumeVarint(b)
+			return n, nil
+
+		case num == 2 && typ == protowire.BytesType:
+			message, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			req, err := consumeProtoRequest(message)
+			ctxData.Req = req
+			return n, err
+
+		case num == 3 && typ == protowire.BytesType:
+			entry, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			stepId, message, err := consumeMapEntry(entry)
+			if err != nil {
+				return n, err
+			}
+			stepData, err := consumeProtoStep(message)
+			if err != nil {
+				return n, fmt.Errorf("step %s: %w", stepId, err)
+			}
+			if ctxData.Step == nil {
+				ctxData.Step = make(map[string]ContextStepData)
+			}
+			ctxData.Step[stepId] = stepData
+			return n, nil
+
+		case num == 4 && typ == protowire.BytesType:
+			entry, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			return n, consumeValueMapEntry(&ctxData.Global, entry)
+
+		case num == 5 && typ == protowire.BytesType:
+			message, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			frame, err := consumeProtoFrame(message)
+			ctxData.Frame = frame
+			return n, err
+		}
+
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if version < 1 || version > CheckpointVersion {
+		return nil, fmt.Errorf("%w: %d", ErrCheckpointVersion, version)
+	}
+
+	return ctxData, nil
+}
+
+func appendProtoRequest(b []byte, req ContextRequestData) []byte {
+	b = appendString(b, 1, req.Method)
+	b = appendString(b, 2, req.Path)
+	b = appendString(b, 3, req.Host)
+	b = appendString(b, 4, req.ClientIP)
+	b = appendValueMap(b, 5, req.Header)
+	b = appendValueMap(b, 6, req.Param)
+	b = appendValueMap(b, 7, req.Query)
+	b = appendValueMap(b, 8, req.Cookie)
+	b = appendValueMap(b, 9, req.Json)
+	b = appendValueMap(b, 10, req.Form)
+
+	for _, field := range sortedKeys(req.File) {
+		var files []byte
+		for _, file := range req.File[field] {
+			var message []byte
+			message = appendString(message, 1, file.Filename)
+			message = appendString(message, 2, file.ContentType)
+			message = appendInt(message, 3, file.Size)
+			files = appendMessage(files, 1, message)
+		}
+		b = appendMapEntry(b, 11, field, files)
+	}
+
+	if req.RawBody != nil {
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, req.RawBody)
+	}
+
+	for _, name := range sortedKeys(req.HeaderValues) {
+		var values []byte
+		for _, value := range req.HeaderValues[name] {
+			values = protowire.AppendTag(values, 1, protowire.BytesType)
+			values = protowire.AppendString(values, value)
+		}
+		b = appendMapEntry(b, 13, name, values)
+	}
+
+	return b
+}
+
+func consumeProtoRequest(data []byte) (ContextRequestData, error) {
+	var req ContextRequestData
+
+	valueMaps := map[protowire.Number]*map[string]any{
+		5: &req.Header, 6: &req.Param, 7: &req.Query, 8: &req.Cookie, 9: &req.Json, 10: &req.Form,
+	}
+	stringFields := map[protowire.Number]*string{
+		1: &req.Method, 2: &req.Path, 3: &req.Host, 4: &req.ClientIP,
+	}
+
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		message, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		switch {
+		case stringFields[num] != nil:
+			*stringFields[num] = string(message)
+
+		case valueMaps[num] != nil:
+			return n, consumeValueMapEntry(valueMaps[num], message)
+
+		case num == 11:
+			field, filesMessage, err := consumeMapEntry(message)
+			if err != nil {
+				return n, err
+			}
+			files, err := consumeProtoFiles(filesMessage)
+			if err != nil {
+				return n, err
+			}
+			if req.File == nil {
+				req.File = make(map[string][]ContextRequestFile)
+			}
+			req.File[field] = files
+
+		case num == 12:
+			req.RawBody = append([]byte{}, message...)
+
+		case num == 13:
+			name, valuesMessage, err := consumeMapEntry(message)
+			if err != nil {
+				return n, err
+			}
+			values := []string{}
+			err = consumeFields(valuesMessage, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				if num != 1 || typ != protowire.BytesType {
+					return protowire.ConsumeFieldValue(num, typ, b), nil
+				}
+				value, n := protowire.ConsumeBytes(b)
+				values = append(values, string(value))
+				return n, nil
+			})
+			if err != nil {
+				return n, err
+			}
+			if req.HeaderValues == nil {
+				req.HeaderValues = make(map[string][]string)
+			}
+			req.HeaderValues[name] = values
+		}
+
+		return n, nil
+	})
+
+	return req, err
+}
+
+func consumeProtoFiles(data []byte) ([]ContextRequestFile, error) {
+	files := []ContextRequestFile{}
+
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 || typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		message, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		var file ContextRequestFile
+		err := consumeFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				value, n := protowire.ConsumeBytes(b)
+				file.Filename = string(value)
+				return n, nil
+			case num == 2 && typ == protowire.BytesType:
+				value, n := protowire.ConsumeBytes(b)
+				file.ContentType = string(value)
+				return n, nil
+			case num == 3 && typ == protowire.VarintType:
+				value, n := protowire.ConsumeVarint(b)
+				file.Size = int64(value)
+				return n, nil
+			}
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		})
+		files = append(files, file)
+
+		return n, err
+	})
+
+	return files, err
+}
+
+func appendProtoStep(b []byte, stepData ContextStepData) []byte {
+	b = appendValueMap(b, 1, stepData.Var)
+
+	var data []byte
+	if stepData.Data.Body != nil {
+		data = appendMessage(data, 1, appendProtoValue(nil, stepData.Data.Body))
+	}
+	data = appendValueMap(data, 2, stepData.Data.Query)
+	data = appendInt(data, 3, int64(stepData.Data.StatusCode))
+	b = appendMessage(b, 2, data)
+	b = appendValueMap(b, 3, stepData.Out)
+
+	var meta []byte
+	meta = appendTime(meta, 1, stepData.Meta.StartTime)
+	meta = appendTime(meta, 2, stepData.Meta.EndTime)
+	meta = appendInt(meta, 3, int64(stepData.Meta.Duration))
+	meta = appendInt(meta, 4, int64(stepData.Meta.Attempts))
+	meta = appendString(meta, 5, stepData.Meta.Error)
+	if stepData.Meta.Truncated {
+		meta = protowire.AppendTag(meta, 6, protowire.VarintType)
+		meta = protowire.AppendVarint(meta, protowire.EncodeBool(true))
+	}
+
+	return appendMessage(b, 4, meta)
+}
+
+func consumeProtoStep(data []byte) (ContextStepData, error) {
+	var stepData ContextStepData
+
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		message, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		switch num {
+		case 1:
+			return n, consumeValueMapEntry(&stepData.Var, message)
+		case 3:
+			return n, consumeValueMapEntry(&stepData.Out, message)
+		case 4:
+			return n, consumeFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch {
+				case num == 5 && typ == protowire.BytesType:
+					value, n := protowire.ConsumeBytes(b)
+					stepData.Meta.Error = string(value)
+					return n, nil
+
+				case typ == protowire.VarintType:
+					raw, n := protowire.ConsumeVarint(b)
+					switch value := int64(raw); num {
+					case 1:
+						stepData.Meta.StartTime = time.Unix(0, value).UTC()
+					case 2:
+						stepData.Meta.EndTime = time.Unix(0, value).UTC()
+					case 3:
+						stepData.Meta.Duration = time.Duration(value)
+					case 4:
+						stepData.Meta.Attempts = int(value)
+					case 6:
+						stepData.Meta.Truncated = protowire.DecodeBool(raw)
+					}
+					return n, nil
+				}
+				return protowire.ConsumeFieldValue(num, typ, b), nil
+			})
+		case 2:
+			return n, consumeFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch {
+				case num == 3 && typ == protowire.VarintType:
+					value, n := protowire.ConsumeVarint(b)
+					stepData.Data.StatusCode = int(int64(value))
+					return n, nil
+
+				case (num == 1 || num == 2) && typ == protowire.BytesType:
+					message, n := protowire.ConsumeBytes(b)
+					if n < 0 {
+						return n, nil
+					}
+					if num == 2 {
+						return n, consumeValueMapEntry(&stepData.Data.Query, message)
+					}
+					body, err := consumeProtoValue(message)
+					stepData.Data.Body = body
+					return n, err
+				}
+				return protowire.ConsumeFieldValue(num, typ, b), nil
+			})
+		}
+
+		return n, nil
+	})
+
+	return stepData, err
+}
+
+func appendProtoFrame(b []byte, frame *ContextFrame) []byte {
+	b = appendString(b, 1, frame.StepId)
+	b = appendInt(b, 2, int64(frame.Index))
+	b = appendMessage(b, 3, appendProtoValue(nil, frame.Item))
+	if frame.Parent != nil {
+		b = appendMessage(b, 4, appendProtoFrame(nil, frame.Parent))
+	}
+	return b
+}
+
+func consumeProtoFrame(data []byte) (*ContextFrame, error) {
+	frame := &ContextFrame{}
+
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 2 && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			frame.Index = int(int64(value))
+			return n, nil
+
+		case typ == protowire.BytesType:
+			message, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+
+			var err error
+			switch num {
+			case 1:
+				frame.StepId = string(message)
+			case 3:
+				frame.Item, err = consumeProtoValue(message)
+			case 4:
+				frame.Parent, err = consumeProtoFrame(message)
+			}
+			return n, err
+		}
+
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+
+	return frame, err
+}
+
+func appendProtoValue(b []byte, value any) []byte {
+	switch typed := value.(type) {
+	case nil:
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		return protowire.AppendVarint(b, 1)
+	case bool:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(typed))
+	case int64:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(typed))
+	case uint64:
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		return protowire.AppendVarint(b, typed)
+	case float64:
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(typed))
+	case string:
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		return protowire.AppendString(b, typed)
+	case []byte:
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		return protowire.AppendBytes(b, typed)
+	case json.Number:
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		return protowire.AppendString(b, string(typed))
+	case []any:
+		var list []byte
+		for _, item := range typed {
+			list = appendMessage(list, 1, appendProtoValue(nil, item))
+		}
+		return appendMessage(b, 9, list)
+	case map[string]any:
+		return appendMessage(b, 10, appendValueMap(nil, 1, typed))
+	}
+
+	// normalized values never get here
+	panic(fmt.Sprintf("unexpected checkpoint value %T", value))
+}
+
+func consumeProtoValue(data []byte) (any, error) {
+	var value any
+
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch typ {
+		case protowire.VarintType:
+			raw, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 1:
+				value = nil
+			case 2:
+				value = protowire.DecodeBool(raw)
+			case 3:
+				value = int64(raw)
+			case 4:
+				value = raw
+			}
+			return n, nil
+
+		case protowire.Fixed64Type:
+			raw, n := protowire.ConsumeFixed64(b)
+			if num == 5 {
+				value = math.Float64frombits(raw)
+			}
+			return n, nil
+
+		case protowire.BytesType:
+			message, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+
+			switch num {
+			case 6:
+				value = string(message)
+			case 7:
+				value = append([]byte{}, message...)
+			case 8:
+				value = json.Number(message)
+			case 9:
+				list := []any{}
+				err := consumeFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					if num != 1 || typ != protowire.BytesType {
+						return protowire.ConsumeFieldValue(num, typ, b), nil
+					}
+					itemMessage, n := protowire.ConsumeBytes(b)
+					if n < 0 {
+						return n, nil
+					}
+					item, err := consumeProtoValue(itemMessage)
+					list = append(list, item)
+					return n, err
+				})
+				value = list
+				return n, err
+			case 10:
+				m := map[string]any{}
+				err := consumeFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					if num != 1 || typ != protowire.BytesType {
+						return protowire.ConsumeFieldValue(num, typ, b), nil
+					}
+					entry, n := protowire.ConsumeBytes(b)
+					if n < 0 {
+						return n, nil
+					}
+					return n, consumeValueMapEntry(&m, entry)
+				})
+				value = m
+				return n, err
+			}
+			return n, nil
+		}
+
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+
+	return value, err
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendInt(b []byte, num protowire.Number, i int64) []byte {
+	if i == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(i))
+}
+
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return appendInt(b, num, t.UnixNano())
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// appendMapEntry appends one entry of a protobuf map, the key is field 1 and the message value is field 2.
+func appendMapEntry(b []byte, num protowire.Number, key string, value []byte) []byte {
+	entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, key)
+	entry = appendMessage(entry, 2, value)
+	return appendMessage(b, num, entry)
+}
+
+// appendValueMap appends a map<string, Value> with sorted keys so the output is deterministic.
+func appendValueMap(b []byte, num protowire.Number, m map[string]any) []byte {
+	for _, key := range sortedKeys(m) {
+		b = appendMapEntry(b, num, key, appendProtoValue(nil, m[key]))
+	}
+	return b
+}
+
+func consumeMapEntry(data []byte) (key string, value []byte, err error) {
+	err = consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		message, n := protowire.ConsumeBytes(b)
+		switch num {
+		case 1:
+			key = string(message)
+		case 2:
+			value = message
+		}
+		return n, nil
+	})
+
+	return key, value, err
+}
+
+func consumeValueMapEntry(m *map[string]any, entry []byte) error {
+	key, message, err := consumeMapEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	value, err := consumeProtoValue(message)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	if *m == nil {
+		*m = make(map[string]any)
+	}
+	(*m)[key] = value
+
+	return nil
+}
+
+// consumeFields reads every field of a message, consume returns the length read from b or a negative
+// protowire error code.
+func consumeFields(data []byte, consume func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("%w: %w", errInvalidProto, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		n, err := consume(num, typ, data)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %w", errInvalidProto, protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,243 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type checkpointUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func newCheckpointContextData() *ContextData {
+	ctxData := &ContextData{}
+	ctxData.SetRequestMethod("POST")
+	ctxData.SetRequestPath("/orders/1")
+	ctxData.SetRequestClientIP("10.0.0.1")
+	ctxData.SetRequestHeaderValues(map[string][]string{"Accept": {"text/html", "application/json"}})
+	ctxData.SetRequestParam(map[string]any{"id": "1"})
+	ctxData.SetRequestQuery(map[string]any{"limit": 10})
+	ctxData.SetRequestJson(map[string]any{
+		"int":      int64(math.MaxInt64),
+		"uint":     uint64(math.MaxUint64),
+		"float":    10.0,
+		"small":    1e-7,
+		"decimal":  json.Number("12345678901234567890.10"),
+		"negative": -3,
+		"null":     nil,
+		"nested":   map[string]any{"list": []any{1, "a", true, 2.5}},
+	})
+	ctxData.SetRequestFile(map[string][]ContextRequestFile{"avatar": {{Filename: "me.png", ContentType: "image/png", Size: 2048}}})
+	ctxData.SetRequestRawBody([]byte(`{"id":1}`))
+	ctxData.SetStepStatusCode("mysql", 200)
+	ctxData.SetStepDataBody("mysql", []map[string]any{{"id": 1, "price": 9.5}})
+	ctxData.SetStepVariable("mysql", map[string]any{"user": checkpointUser{Name: "John", Age: 30}})
+	ctxData.SetStepOutput("mysql", map[string]any{"total": int32(2)})
+	ctxData.SetStepStartTime("mysql", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	ctxData.SetStepEndTime("mysql", time.Date(2024, 1, 1, 10, 0, 1, 500, time.UTC))
+	ctxData.SetStepAttempts("mysql", 2)
+	ctxData.SetStepError("mysql", errors.New("deadlock, retried"))
+	ctxData.SetGlobal("user_id", 7)
+
+	return ctxData
+}
+
+// the restored values of newCheckpointContextData, integers are int64 and lists are []any
+func wantCheckpointContextData() *ContextData {
+	return &ContextData{
+		Req: ContextRequestData{
+			Method:       "POST",
+			Path:         "/orders/1",
+			ClientIP:     "10.0.0.1",
+			Header:       map[string]any{"Accept": "text/html"},
+			HeaderValues: map[string][]string{"Accept": {"text/html", "application/json"}},
+			Param:        map[string]any{"id": "1"},
+			Query:        map[string]any{"limit": int64(10)},
+			Json: map[string]any{
+				"int":      int64(math.MaxInt64),
+				"uint":     uint64(math.MaxUint64),
+				"float":    10.0,
+				"small":    1e-7,
+				"decimal":  json.Number("12345678901234567890.10"),
+				"negative": int64(-3),
+				"null":     nil,
+				"nested":   map[string]any{"list": []any{int64(1), "a", true, 2.5}},
+			},
+			File:    map[string][]ContextRequestFile{"avatar": {{Filename: "me.png", ContentType: "image/png", Size: 2048}}},
+			RawBody: []byte(`{"id":1}`),
+		},
+		Step: map[string]ContextStepData{
+			"mysql": {
+				Var: map[string]any{"user": map[string]any{"name": "John", "age": int64(30)}},
+				Data: ContextStepDataBody{
+					Body:       []any{map[string]any{"id": int64(1), "price": 9.5}},
+					StatusCode: 200,
+				},
+				Out: map[string]any{"total": int64(2)},
+				Meta: ContextStepMeta{
+					StartTime: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+					EndTime:   time.Date(2024, 1, 1, 10, 0, 1, 500, time.UTC),
+					Duration:  time.Second + 500,
+					Attempts:  2,
+					Error:     "deadlock, retried",
+				},
+			},
+		},
+		Global: map[string]any{"user_id": int64(7)},
+	}
+}
+
+func TestContextData_checkpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		marshal   func(*ContextData) ([]byte, error)
+		unmarshal func([]byte) (*ContextData, error)
+	}{
+		{
+			name:      "json",
+			marshal:   (*ContextData).MarshalCheckpointJSON,
+			unmarshal: UnmarshalCheckpointJSON,
+		},
+		{
+			name:      "protobuf",
+			marshal:   (*ContextData).MarshalCheckpointProto,
+			unmarshal: UnmarshalCheckpointProto,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.marshal(newCheckpointContextData())
+			assert.NoError(t, err)
+
+			got, err := tt.unmarshal(data)
+			assert.NoError(t, err)
+
+			want := wantCheckpointContextData()
+			assert.Equal(t, want.Req, got.Req)
+			assert.Equal(t, want.Step, got.Step)
+			assert.Equal(t, want.Global, got.Global)
+
+			// the restored context is ready to use
+			got.SetStepStatusCode("end", 201)
+			assert.Equal(t, 201, got.GetStep("end").Data.StatusCode)
+
+			// the output is deterministic
+			again, err := tt.marshal(got.Snapshot())
+			assert.NoError(t, err)
+			restoredAgain, err := tt.unmarshal(again)
+			assert.NoError(t, err)
+			assert.Equal(t, got.Step, restoredAgain.Step)
+		})
+	}
+}
+
+func TestContextData_checkpointIteration(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestMethod("POST")
+	ctxData.SetStepOutput("start", map[string]any{"rows": 2})
+	ctxData.SetGlobal("user_id", 1)
+
+	outer := ctxData.NewIteration("foreach", 1, map[string]any{"id": 7})
+	inner := outer.NewIteration("retry", 0, "first")
+	inner.SetStepOutput("body", map[string]any{"status": "ok"})
+
+	branch := ctxData.Fork()
+	branch.SetGlobal("side", "left")
+
+	for name, marshal := range map[string]func(*ContextData) ([]byte, error){
+		"json":     (*ContextData).MarshalCheckpointJSON,
+		"protobuf": (*ContextData).MarshalCheckpointProto,
+	} {
+		t.Run(name, func(t *testing.T) {
+			unmarshal := UnmarshalCheckpointJSON
+			if name == "protobuf" {
+				unmarshal = UnmarshalCheckpointProto
+			}
+
+			// an iteration keeps the data of its parents and its frames
+			data, err := marshal(inner)
+			assert.NoError(t, err)
+			got, err := unmarshal(data)
+			assert.NoError(t, err)
+
+			assert.Equal(t, "POST", got.Req.Method)
+			assert.Equal(t, int64(2), got.Step["start"].Out["rows"])
+			assert.Equal(t, "ok", got.Step["body"].Out["status"])
+			assert.Equal(t, map[string]any{"user_id": int64(1)}, got.Global)
+			assert.Equal(t, &ContextFrame{
+				StepId: "retry",
+				Index:  0,
+				Item:   "first",
+				Parent: &ContextFrame{StepId: "foreach", Index: 1, Item: map[string]any{"id": int64(7)}},
+			}, got.Frame)
+
+			// a branch keeps the global variables of the execution and its own
+			data, err = marshal(branch)
+			assert.NoError(t, err)
+			got, err = unmarshal(data)
+			assert.NoError(t, err)
+
+			assert.Equal(t, int64(2), got.Step["start"].Out["rows"])
+			assert.Equal(t, map[string]any{"user_id": int64(1), "side": "left"}, got.Global)
+			assert.Nil(t, got.Frame)
+		})
+	}
+}
+
+func TestContextData_checkpointVersion(t *testing.T) {
+	_, err := UnmarshalCheckpointJSON([]byte(`{"version": 2, "req": {}}`))
+	assert.ErrorIs(t, err, ErrCheckpointVersion)
+
+	_, err = UnmarshalCheckpointJSON([]byte(`{"req": {}}`))
+	assert.ErrorIs(t, err, ErrCheckpointVersion)
+
+	_, err = UnmarshalCheckpointProto([]byte{0x08, 0x02}) // version = 2
+	assert.ErrorIs(t, err, ErrCheckpointVersion)
+
+	_, err = UnmarshalCheckpointProto([]byte{0x08})
+	assert.Error(t, err)
+}
+
+func TestContextData_checkpointUnsupportedValue(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestJson(map[string]any{"nan": math.NaN()})
+
+	_, err := ctxData.MarshalCheckpointJSON()
+	assert.Error(t, err)
+
+	ctxData.SetRequestJson(map[string]any{"func": func() {}})
+	_, err = ctxData.MarshalCheckpointProto()
+	assert.Error(t, err)
+}
+
+func TestContextData_checkpointConcurrent(t *testing.T) {
+	var (
+		ctxData = newCheckpointContextData()
+		wg      sync.WaitGroup
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ctxData.SetStepDataBody("mysql", map[string]any{"i": i})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, err := ctxData.MarshalCheckpointJSON()
+			assert.NoError(t, err)
+			_, err = ctxData.MarshalCheckpointProto()
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+}
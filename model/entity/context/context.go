@@ -1,26 +1,76 @@
 package context
 
 import (
+	"errors"
+	"net/textproto"
 	"sync"
+	"time"
 )
 
+// ErrNotExecution is returned by the setters of the request data of an iteration or a branch, the request data is
+// the one of the execution.
+var ErrNotExecution = errors.New("request data can only be set on the context data of the execution")
+
 // ContextData data
+//
+// Every setter of the data keeps a deep copy of its value, the value can be changed after the set, and returns the
+// *BudgetError of a value over the budget, always nil when no budget is set, see SetBudget.
 type ContextData struct {
 	sync.RWMutex
-	Req  ContextRequestData         `json:",omitempty"` // data from http request
-	Step map[string]ContextStepData `json:",omitempty"` // map[StepId]StepData
+	Req    ContextRequestData         `json:",omitempty"` // data from http request
+	Step   map[string]ContextStepData `json:",omitempty"` // map[StepId]StepData
+	Global map[string]any             `json:",omitempty"` // map[Key]Value. Variables shared by every step, see SetGlobal
+	Frame  *ContextFrame              `json:",omitempty"` // current iteration, see NewIteration
+
+	parent      *ContextData         // context data the iteration or the branch is created from
+	isBranch    bool                 // see Fork
+	base        *ContextData         // view of the parent at the fork, see Merge
+	written     map[sizeKey]struct{} // fields written by the branch, see Merge
+	observer    IChangeObserver
+	executionId string        // see SetExecutionId
+	changes     []ChangeEvent // changes waiting for the observer, see unlockAndFlush
+	budget      Budget
+	sizes       map[sizeKey]int64 // estimated size of each field set, created on the first set
+	totalSize   int64
 }
 
 type ContextRequestData struct {
-	Header map[string]any `json:",omitempty"`
-	Query  map[string]any `json:",omitempty"` // map[queryVar]Value
-	Json   map[string]any `json:",omitempty"` // map[jsonVar]Value
+	Method       string                          `json:",omitempty"`
+	Path         string                          `json:",omitempty"` // request path, ex: /users/123
+	Host         string                          `json:",omitempty"`
+	ClientIP     string                          `json:",omitempty"`
+	Header       map[string]any                  `json:",omitempty"` // map[CanonicalName]FirstValue, ex: Content-Type, see GetHeader
+	HeaderValues map[string][]string             `json:",omitempty"` // map[CanonicalName]Values, every value of repeated headers
+	Param        map[string]any                  `json:",omitempty"` // map[pathParam]Value, ex: id of /users/{id}
+	Query        map[string]any                  `json:",omitempty"` // map[queryVar]Value
+	Cookie       map[string]any                  `json:",omitempty"` // map[cookieName]Value
+	Json         map[string]any                  `json:",omitempty"` // map[jsonVar]Value
+	Form         map[string]any                  `json:",omitempty"` // map[formField]Value. Urlencoded and multipart fields
+	File         map[string][]ContextRequestFile `json:",omitempty"` // map[formField]Files. Multipart files metadata
+	RawBody      []byte                          `json:",omitempty"`
+}
+
+// ContextRequestFile is the metadata of a multipart file, the content is not kept in the context.
+type ContextRequestFile struct {
+	Filename    string
+	ContentType string `json:",omitempty"`
+	Size        int64
 }
 
 type ContextStepData struct {
 	Var  map[string]any      `json:",omitempty"` // map[Var]Value. Data from step variables
 	Data ContextStepDataBody `json:",omitempty"` // body response. For database in JSON form
 	Out  map[string]any      `json:",omitempty"` // map[OutputVar]Value
+	Meta ContextStepMeta     // execution of the step, for traces, logs and timelines
+}
+
+type ContextStepMeta struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration `json:",omitempty"` // EndTime - StartTime
+	Attempts  int           `json:",omitempty"`
+	Error     string        `json:",omitempty"` // error of the last attempt
+	Truncated bool          `json:",omitempty"` // data cut to fit the budget, see BudgetPolicyTruncate
 }
 
 type ContextStepDataBody struct {
@@ -29,55 +79,393 @@ type ContextStepDataBody struct {
 	StatusCode int            `json:"status_code"`
 }
 
-func (ctxData *ContextData) SetRequestQuery(query map[string]any) {
-	ctxData.Lock()
-	ctxData.Req.Query = query
-	ctxData.Unlock()
+// Snapshot returns a deep copy of the context data taken under the read lock. The copy can be read, ex: by
+// templates, while other steps keep writing into the context.
+func (ctxData *ContextData) Snapshot() *ContextData {
+	if ctxData == nil {
+		return &ContextData{}
+	}
+
+	// the snapshot of an iteration or a branch is the snapshot of its parent with its own data
+	snapshot := &ContextData{}
+	if ctxData.parent != nil {
+		snapshot = ctxData.parent.Snapshot()
+	}
+
+	ctxData.RLock()
+	defer ctxData.RUnlock()
+
+	if ctxData.parent == nil {
+		snapshot.Req = ctxData.Req.deepCopy()
+	}
+
+	if ctxData.Global != nil {
+		if snapshot.Global == nil {
+			snapshot.Global = make(map[string]any, len(ctxData.Global))
+		}
+		for key, value := range ctxData.Global {
+			snapshot.Global[key] = deepCopy(value)
+		}
+	}
+
+	if ctxData.Step != nil {
+		if snapshot.Step == nil {
+			snapshot.Step = make(map[string]ContextStepData, len(ctxData.Step))
+		}
+		for stepId, stepData := range ctxData.Step {
+			snapshot.Step[stepId] = stepData.deepCopy()
+		}
+	}
+
+	snapshot.Frame = ctxData.Frame.deepCopy()
+
+	return snapshot
 }
 
-func (ctxData *ContextData) SetRequestJson(json map[string]any) {
-	ctxData.Lock()
-	ctxData.Req.Json = json
-	ctxData.Unlock()
+// View returns a flattened copy of the context data taken under the read lock, cheaper than Snapshot as only the
+// maps of the steps and the global variables are copied, their values are shared. A value set in the context
+// data is a copy replaced by the next set and never changed, so the view can be read while other steps keep
+// writing.
+// A value read from a view must be copied before it's changed, see DeepCopy.
+func (ctxData *ContextData) View() *ContextData {
+	if ctxData == nil {
+		return &ContextData{}
+	}
+
+	// the view of an iteration or a branch is the view of its parent with its own data
+	view := &ContextData{}
+	if ctxData.parent != nil {
+		view = ctxData.parent.View()
+	}
+
+	ctxData.RLock()
+	defer ctxData.RUnlock()
+
+	if ctxData.parent == nil {
+		view.Req = ctxData.Req
+	}
+
+	if ctxData.Global != nil {
+		if view.Global == nil {
+			view.Global = make(map[string]any, len(ctxData.Global))
+		}
+		for key, value := range ctxData.Global {
+			view.Global[key] = value
+		}
+	}
+
+	if ctxData.Step != nil {
+		if view.Step == nil {
+			view.Step = make(map[string]ContextStepData, len(ctxData.Step))
+		}
+		for stepId, stepData := range ctxData.Step {
+			view.Step[stepId] = stepData
+		}
+	}
+
+	view.Frame = ctxData.Frame
+
+	return view
 }
 
-func (ctxData *ContextData) GetStep(stepId string) ContextStepData {
-	if ctxData.Step == nil {
-		ctxData.Step = make(map[string]ContextStepData)
+// GetRequest returns a deep copy of the request data.
+func (ctxData *ContextData) GetRequest() ContextRequestData {
+	if ctxData.parent != nil {
+		return ctxData.parent.GetRequest()
+	}
+
+	ctxData.RLock()
+	defer ctxData.RUnlock()
+
+	return ctxData.Req.deepCopy()
+}
+
+func (ctxData *ContextData) SetRequestMethod(method string) error {
+	return ctxData.setRequest("Method", sizedString(method), func() { ctxData.Req.Method = method })
+}
+
+func (ctxData *ContextData) SetRequestPath(path string) error {
+	return ctxData.setRequest("Path", sizedString(path), func() { ctxData.Req.Path = path })
+}
+
+func (ctxData *ContextData) SetRequestHost(host string) error {
+	return ctxData.setRequest("Host", sizedString(host), func() { ctxData.Req.Host = host })
+}
+
+func (ctxData *ContextData) SetRequestClientIP(clientIP string) error {
+	return ctxData.setRequest("ClientIP", sizedString(clientIP), func() { ctxData.Req.ClientIP = clientIP })
+}
+
+// SetRequestHeader sets the request headers, names are canonicalized and a value can be a list of values. The
+// values of names differing by case are merged in the order of the names, ex: "X-Id" before "x-id".
+func (ctxData *ContextData) SetRequestHeader(header map[string]any) error {
+	values := make(map[string][]string, len(header))
+	for _, name := range sortedKeys(header) {
+		canonicalName := textproto.CanonicalMIMEHeaderKey(name)
+		values[canonicalName] = append(values[canonicalName], toHeaderValues(header[name])...)
 	}
+	return ctxData.SetRequestHeaderValues(values)
+}
+
+// SetRequestHeaderValues sets the request headers from every value of each header, ex: an http.Header.
+func (ctxData *ContextData) SetRequestHeaderValues(header map[string][]string) error {
+	var (
+		first  = make(map[string]any, len(header))
+		values = make(map[string][]string, len(header))
+	)
+	for _, name := range sortedKeys(header) {
+		canonicalName := textproto.CanonicalMIMEHeaderKey(name)
+		values[canonicalName] = append(values[canonicalName], header[name]...)
+		if len(values[canonicalName]) > 0 {
+			first[canonicalName] = values[canonicalName][0]
+		}
+	}
+
+	return ctxData.setRequest("Header", requestHeader{first, values}, func() {
+		ctxData.Req.Header = first
+		ctxData.Req.HeaderValues = values
+	})
+}
+
+func (ctxData *ContextData) SetRequestParam(param map[string]any) error {
+	param = copyMap(param)
+	return ctxData.setRequest("Param", param, func() {
+		ctxData.Req.Param = param
+	})
+}
+
+func (ctxData *ContextData) SetRequestQuery(query map[string]any) error {
+	query = copyMap(query)
+	return ctxData.setRequest("Query", query, func() {
+		ctxData.Req.Query = query
+	})
+}
+
+func (ctxData *ContextData) SetRequestCookie(cookie map[string]any) error {
+	cookie = copyMap(cookie)
+	return ctxData.setRequest("Cookie", cookie, func() {
+		ctxData.Req.Cookie = cookie
+	})
+}
+
+func (ctxData *ContextData) SetRequestJson(json map[string]any) error {
+	json = copyMap(json)
+	return ctxData.setRequest("Json", json, func() {
+		ctxData.Req.Json = json
+	})
+}
+
+func (ctxData *ContextData) SetRequestForm(form map[string]any) error {
+	form = copyMap(form)
+	return ctxData.setRequest("Form", form, func() {
+		ctxData.Req.Form = form
+	})
+}
 
-	stepData, _ := ctxData.Step[stepId]
+func (ctxData *ContextData) SetRequestFile(file map[string][]ContextRequestFile) error {
+	file = copyFiles(file)
+	return ctxData.setRequest("File", file, func() {
+		ctxData.Req.File = file
+	})
+}
+
+func (ctxData *ContextData) SetRequestRawBody(rawBody []byte) error {
+	rawBody = copyBytes(rawBody)
+	return ctxData.setRequest("RawBody", rawBody, func() {
+		ctxData.Req.RawBody = rawBody
+	})
+}
+
+// GetStep returns a deep copy of the step data, the zero value when the step has no data yet.
+func (ctxData *ContextData) GetStep(stepId string) ContextStepData {
+	stepData, _ := ctxData.lookupStep(stepId)
 	return stepData
 }
 
-func (ctxData *ContextData) SetStepStatusCode(stepId string, statusCode int) {
+// lookupStep returns a deep copy of the step data of the context data or of its parents.
+func (ctxData *ContextData) lookupStep(stepId string) (ContextStepData, bool) {
+	ctxData.RLock()
+	stepData, ok := ctxData.Step[stepId]
+	if ok {
+		stepData = stepData.deepCopy()
+	}
+	ctxData.RUnlock()
+
+	if !ok && ctxData.parent != nil {
+		return ctxData.parent.lookupStep(stepId)
+	}
+
+	return stepData, ok
+}
+
+func (ctxData *ContextData) SetStepStatusCode(stepId string, statusCode int) error {
+	return ctxData.setStep(stepId, sizeFieldStatusCode, sizedStatusCode(statusCode), func(stepData *ContextStepData, _ any) {
+		stepData.Data.StatusCode = statusCode
+	})
+}
+
+// SetStepStartTime marks the start of an attempt of the step, the end time and error of a previous attempt
+// are cleared.
+func (ctxData *ContextData) SetStepStartTime(stepId string, startTime time.Time) error {
+	return ctxData.setStepMeta(stepId, func(meta *ContextStepMeta) {
+		meta.StartTime = startTime
+		meta.EndTime = time.Time{}
+		meta.Duration = 0
+		meta.Error = ""
+	})
+}
+
+// SetStepEndTime marks the end of the step and sets its duration from the start time.
+func (ctxData *ContextData) SetStepEndTime(stepId string, endTime time.Time) error {
+	return ctxData.setStepMeta(stepId, func(meta *ContextStepMeta) {
+		meta.EndTime = endTime
+		if !meta.StartTime.IsZero() {
+			meta.Duration = endTime.Sub(meta.StartTime)
+		}
+	})
+}
+
+func (ctxData *ContextData) SetStepAttempts(stepId string, attempts int) error {
+	return ctxData.setStepMeta(stepId, func(meta *ContextStepMeta) {
+		meta.Attempts = attempts
+	})
+}
+
+// SetStepError records the error of the step, a nil error clears it.
+func (ctxData *ContextData) SetStepError(stepId string, err error) error {
+	return ctxData.setStepMeta(stepId, func(meta *ContextStepMeta) {
+		meta.Error = ""
+		if err != nil {
+			meta.Error = err.Error()
+		}
+	})
+}
+
+func (ctxData *ContextData) SetStepDataBody(stepId string, body any) error {
+	body = deepCopy(body)
+	return ctxData.setStep(stepId, sizeFieldBody, body, func(stepData *ContextStepData, value any) {
+		stepData.Data.Body = value
+	})
+}
+
+func (ctxData *ContextData) SetStepVariable(stepId string, data map[string]any) error {
+	data = copyMap(data)
+	return ctxData.setStep(stepId, sizeFieldVar, data, func(stepData *ContextStepData, value any) {
+		stepData.Var, _ = value.(map[string]any)
+	})
+}
+
+func (ctxData *ContextData) SetStepOutput(stepId string, data map[string]any) error {
+	data = copyMap(data)
+	return ctxData.setStep(stepId, sizeFieldOut, data, func(stepData *ContextStepData, value any) {
+		stepData.Out, _ = value.(map[string]any)
+	})
+}
+
+// setRequest sets a field of the request data when it fits the budget, request data is never truncated.
+func (ctxData *ContextData) setRequest(field string, value any, set func()) error {
+	if ctxData.parent != nil {
+		return ErrNotExecution
+	}
+
 	ctxData.Lock()
-	stepData := ctxData.GetStep(stepId)
-	stepData.Data.StatusCode = statusCode
-	ctxData.Step[stepId] = stepData
-	ctxData.Unlock()
+	defer ctxData.unlockAndFlush()
+
+	key := sizeKey{field: field}
+	_, size, _, err := ctxData.fitValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	set()
+	ctxData.recordChange(key, ctxData.sizes[key], size)
+	ctxData.recordSize(key, size)
+	return nil
 }
 
-func (ctxData *ContextData) SetStepDataBody(stepId string, body any) {
+// setStep sets a field of the step data with the value fitting the budget, see BudgetPolicy.
+func (ctxData *ContextData) setStep(stepId, field string, value any, set func(stepData *ContextStepData, value any)) error {
 	ctxData.Lock()
-	stepData := ctxData.GetStep(stepId)
-	stepData.Data.Body = body
-	ctxData.Step[stepId] = stepData
-	ctxData.Unlock()
+	defer ctxData.unlockAndFlush()
+
+	return ctxData.setStepLocked(stepId, field, value, set)
+}
+
+func (ctxData *ContextData) setStepLocked(stepId, field string, value any, set func(stepData *ContextStepData, value any)) error {
+	ctxData.copyParentStepLocked(stepId)
+
+	key := sizeKey{stepId: stepId, field: field}
+	value, size, truncated, err := ctxData.fitValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	ctxData.updateStepLocked(stepId, func(stepData *ContextStepData) {
+		set(stepData, value)
+		if truncated {
+			stepData.Meta.Truncated = true
+		}
+	})
+	ctxData.recordChange(key, ctxData.sizes[key], size)
+	ctxData.recordSize(key, size)
+	return nil
 }
 
-func (ctxData *ContextData) SetStepVariable(stepId string, data map[string]any) {
+// setStepMeta changes the execution metadata of a step, its error fits the budget like a string.
+func (ctxData *ContextData) setStepMeta(stepId string, update func(meta *ContextStepMeta)) error {
 	ctxData.Lock()
-	stepData := ctxData.GetStep(stepId)
-	stepData.Var = data
+	defer ctxData.unlockAndFlush()
+
+	ctxData.copyParentStepLocked(stepId)
+	meta := ctxData.Step[stepId].Meta
+	update(&meta)
+
+	return ctxData.setStepMetaLocked(stepId, meta)
+}
+
+func (ctxData *ContextData) setStepMetaLocked(stepId string, meta ContextStepMeta) error {
+	return ctxData.setStepLocked(stepId, sizeFieldMeta, sizedMeta(meta), func(stepData *ContextStepData, value any) {
+		truncated := stepData.Meta.Truncated || meta.Truncated
+		stepData.Meta = meta
+		stepData.Meta.Error, _ = value.(string)
+		stepData.Meta.Truncated = truncated
+	})
+}
+
+func (ctxData *ContextData) updateStepLocked(stepId string, update func(stepData *ContextStepData)) {
+	ctxData.copyParentStepLocked(stepId)
+
+	if ctxData.Step == nil {
+		ctxData.Step = make(map[string]ContextStepData)
+	}
+
+	stepData := ctxData.Step[stepId]
+	update(&stepData)
 	ctxData.Step[stepId] = stepData
-	ctxData.Unlock()
 }
 
-func (ctxData *ContextData) SetStepOutput(stepId string, data map[string]any) {
-	ctxData.Lock()
-	stepData := ctxData.GetStep(stepId)
-	stepData.Out = data
+// copyParentStepLocked copies the data the parent has for a step before the first write of an iteration or a
+// branch into the step, so the parent is never changed.
+func (ctxData *ContextData) copyParentStepLocked(stepId string) {
+	if ctxData.parent == nil {
+		return
+	}
+	if _, ok := ctxData.Step[stepId]; ok {
+		return
+	}
+
+	stepData, ok := ctxData.parent.lookupStep(stepId)
+	if !ok {
+		return
+	}
+
+	if ctxData.Step == nil {
+		ctxData.Step = make(map[string]ContextStepData)
+	}
 	ctxData.Step[stepId] = stepData
-	ctxData.Unlock()
+
+	ctxData.initSizes()
+	for field, value := range stepData.sizedFields() {
+		ctxData.recordSize(sizeKey{stepId, field}, estimateSize(value))
+	}
 }
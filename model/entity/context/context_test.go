@@ -0,0 +1,271 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextData_Snapshot(t *testing.T) {
+	ctxData := &ContextData{
+		Req: ContextRequestData{
+			Json: map[string]any{
+				"user": map[string]any{"name": "John"},
+				"tags": []any{"a", "b"},
+			},
+		},
+	}
+	ctxData.SetStepDataBody("step_1", map[string]any{"items": []map[string]any{{"id": 1}}})
+	ctxData.SetStepOutput("step_1", map[string]any{"out": "value"})
+
+	snapshot := ctxData.Snapshot()
+	assert.Equal(t, ctxData.Req, snapshot.Req)
+	assert.Equal(t, ctxData.Step, snapshot.Step)
+
+	// changes on the snapshot don't reach the context
+	snapshot.Req.Json["user"].(map[string]any)["name"] = "Jane"
+	snapshot.Req.Json["tags"].([]any)[0] = "z"
+	snapshot.Step["step_1"].Data.Body.(map[string]any)["items"].([]map[string]any)[0]["id"] = 2
+	snapshot.Step["step_1"].Out["out"] = "changed"
+
+	assert.Equal(t, "John", ctxData.Req.Json["user"].(map[string]any)["name"])
+	assert.Equal(t, "a", ctxData.Req.Json["tags"].([]any)[0])
+	assert.Equal(t, 1, ctxData.Step["step_1"].Data.Body.(map[string]any)["items"].([]map[string]any)[0]["id"])
+	assert.Equal(t, "value", ctxData.Step["step_1"].Out["out"])
+
+	// a nil context has an empty snapshot
+	var nilCtxData *ContextData
+	assert.Equal(t, &ContextData{}, nilCtxData.Snapshot())
+}
+
+func TestContextData_cyclicValue(t *testing.T) {
+	out := map[string]any{"rows": []any{1}}
+	out["self"] = out
+
+	ctxData := &ContextData{}
+	assert.NoError(t, ctxData.SetStepOutput("step_1", out))
+	assert.Greater(t, ctxData.StepSize("step_1"), int64(0))
+
+	// the copy contains itself, not the original
+	copied := ctxData.GetStep("step_1").Out
+	assert.Equal(t, []any{1}, copied["rows"])
+	self := copied["self"].(map[string]any)
+	self["rows"] = "changed"
+	assert.Equal(t, "changed", copied["rows"])
+	assert.Equal(t, []any{1}, out["rows"])
+}
+
+func TestContextData_View(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestJson(map[string]any{"user": "John"})
+	ctxData.SetStepOutput("step_1", map[string]any{"out": "value"})
+	ctxData.SetGlobal("user_id", 1)
+
+	iteration := ctxData.NewIteration("foreach", 1, "b")
+	iteration.SetStepOutput("body", map[string]any{"out": "item"})
+
+	view := iteration.View()
+	assert.Equal(t, map[string]any{"user": "John"}, view.Req.Json)
+	assert.Equal(t, "value", view.Step["step_1"].Out["out"])
+	assert.Equal(t, "item", view.Step["body"].Out["out"])
+	assert.Equal(t, map[string]any{"user_id": 1}, view.Global)
+	assert.Equal(t, "b", view.Frame.Item)
+
+	// the writes after the view are not seen
+	ctxData.SetStepOutput("step_1", map[string]any{"out": "changed"})
+	ctxData.SetStepOutput("step_2", map[string]any{"out": "new"})
+	ctxData.SetGlobal("user_id", 2)
+	assert.Equal(t, "value", view.Step["step_1"].Out["out"])
+	assert.NotContains(t, view.Step, "step_2")
+	assert.Equal(t, 1, view.Global["user_id"])
+
+	// the values are copied when they are set, changing them later changes neither the context nor the view
+	var (
+		json   = map[string]any{"user": "John"}
+		out    = map[string]any{"out": []any{"a"}}
+		body   = []any{map[string]any{"id": 1}}
+		global = map[string]any{"id": 1}
+		item   = map[string]any{"id": 1}
+	)
+	ctxData.SetRequestJson(json)
+	ctxData.SetStepOutput("step_3", out)
+	ctxData.SetStepDataBody("step_3", body)
+	ctxData.SetGlobal("user", global)
+	iteration = ctxData.NewIteration("foreach", 0, item)
+	view = iteration.View()
+
+	json["user"] = "Jane"
+	out["out"].([]any)[0] = "b"
+	body[0].(map[string]any)["id"] = 2
+	global["id"] = 2
+	item["id"] = 2
+	for _, view := range []*ContextData{view, iteration.View()} {
+		assert.Equal(t, "John", view.Req.Json["user"])
+		assert.Equal(t, []any{"a"}, view.Step["step_3"].Out["out"])
+		assert.Equal(t, []any{map[string]any{"id": 1}}, view.Step["step_3"].Data.Body)
+		assert.Equal(t, map[string]any{"id": 1}, view.Global["user"])
+		assert.Equal(t, map[string]any{"id": 1}, view.Frame.Item)
+	}
+
+	// a nil context has an empty view
+	var nilCtxData *ContextData
+	assert.Equal(t, &ContextData{}, nilCtxData.View())
+}
+
+func TestContextData_SetRequest(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestMethod("POST")
+	ctxData.SetRequestPath("/users/123")
+	ctxData.SetRequestHost("api.example.com")
+	ctxData.SetRequestClientIP("10.0.0.1")
+	ctxData.SetRequestHeader(map[string]any{"Content-Type": "multipart/form-data"})
+	ctxData.SetRequestParam(map[string]any{"id": "123"})
+	ctxData.SetRequestCookie(map[string]any{"session": "abc"})
+	ctxData.SetRequestForm(map[string]any{"name": "John"})
+	ctxData.SetRequestFile(map[string][]ContextRequestFile{"avatar": {{Filename: "me.png", Size: 10}}})
+	ctxData.SetRequestRawBody([]byte("raw"))
+
+	req := ctxData.GetRequest()
+	assert.Equal(t, ContextRequestData{
+		Method:       "POST",
+		Path:         "/users/123",
+		Host:         "api.example.com",
+		ClientIP:     "10.0.0.1",
+		Header:       map[string]any{"Content-Type": "multipart/form-data"},
+		HeaderValues: map[string][]string{"Content-Type": {"multipart/form-data"}},
+		Param:        map[string]any{"id": "123"},
+		Cookie:       map[string]any{"session": "abc"},
+		Form:         map[string]any{"name": "John"},
+		File:         map[string][]ContextRequestFile{"avatar": {{Filename: "me.png", Size: 10}}},
+		RawBody:      []byte("raw"),
+	}, req)
+
+	// the copy doesn't share the files and the raw body
+	req.File["avatar"][0].Filename = "changed"
+	req.RawBody[0] = 'R'
+	assert.Equal(t, "me.png", ctxData.Req.File["avatar"][0].Filename)
+	assert.Equal(t, []byte("raw"), ctxData.Req.RawBody)
+}
+
+func TestContextData_SetRequestHeader(t *testing.T) {
+	ctxData := &ContextData{}
+
+	assert.NoError(t, ctxData.SetRequestHeader(map[string]any{
+		"authorization":   "Bearer abc",
+		"x-forwarded-for": []any{"10.0.0.1", "10.0.0.2"},
+		"Accept":          "text/html",
+		"ACCEPT":          []string{"application/json"},
+	}))
+
+	req := ctxData.GetRequest()
+	assert.Equal(t, "Bearer abc", req.Header["Authorization"])
+	assert.Equal(t, "10.0.0.1", req.Header["X-Forwarded-For"])
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, req.HeaderValues["X-Forwarded-For"])
+	// names differing by case are merged in the order of the names
+	assert.Equal(t, []string{"application/json", "text/html"}, req.GetHeaderValues("accept"))
+	assert.Equal(t, "application/json", req.Header["Accept"])
+	assert.Equal(t, "Bearer abc", req.GetHeader("AUTHORIZATION"))
+	assert.Empty(t, req.GetHeader("unknown"))
+	assert.Nil(t, req.GetHeaderValues("unknown"))
+
+	// an http.Header is a map[string][]string
+	assert.NoError(t, ctxData.SetRequestHeaderValues(map[string][]string{"content-type": {"application/json"}, "X-Empty": {}}))
+	req = ctxData.GetRequest()
+	assert.Equal(t, map[string]any{"Content-Type": "application/json"}, req.Header)
+	assert.Equal(t, map[string][]string{"Content-Type": {"application/json"}, "X-Empty": nil}, req.HeaderValues)
+
+	// headers not set by the setters are found regardless of their case
+	req = ContextRequestData{Header: map[string]any{"x-custom": "value"}}
+	assert.Equal(t, "value", req.GetHeader("X-Custom"))
+}
+
+func TestContextData_GetStep(t *testing.T) {
+	ctxData := &ContextData{}
+
+	assert.Equal(t, ContextStepData{}, ctxData.GetStep("unknown"))
+	assert.Nil(t, ctxData.Step, "reading doesn't create the step map")
+
+	ctxData.SetStepStatusCode("step_1", 200)
+	ctxData.SetStepVariable("step_1", map[string]any{"var": "value"})
+
+	stepData := ctxData.GetStep("step_1")
+	assert.Equal(t, 200, stepData.Data.StatusCode)
+
+	stepData.Var["var"] = "changed"
+	assert.Equal(t, "value", ctxData.GetStep("step_1").Var["var"])
+}
+
+func TestContextData_SetStepMeta(t *testing.T) {
+	var (
+		ctxData   = &ContextData{}
+		startTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	)
+
+	ctxData.SetStepStartTime("step_1", startTime)
+	ctxData.SetStepAttempts("step_1", 1)
+	ctxData.SetStepError("step_1", errors.New("timeout"))
+	ctxData.SetStepEndTime("step_1", startTime.Add(2*time.Second))
+	assert.Equal(t, ContextStepMeta{
+		StartTime: startTime,
+		EndTime:   startTime.Add(2 * time.Second),
+		Duration:  2 * time.Second,
+		Attempts:  1,
+		Error:     "timeout",
+	}, ctxData.GetStep("step_1").Meta)
+
+	// a new attempt clears the result of the previous one
+	ctxData.SetStepStartTime("step_1", startTime.Add(3*time.Second))
+	ctxData.SetStepAttempts("step_1", 2)
+	assert.Equal(t, ContextStepMeta{StartTime: startTime.Add(3 * time.Second), Attempts: 2}, ctxData.GetStep("step_1").Meta)
+
+	ctxData.SetStepError("step_1", nil)
+	assert.Empty(t, ctxData.GetStep("step_1").Meta.Error)
+
+	// without a start time there is no duration
+	ctxData.SetStepEndTime("step_2", startTime)
+	assert.Zero(t, ctxData.GetStep("step_2").Meta.Duration)
+}
+
+func TestContextData_concurrent(t *testing.T) {
+	var (
+		ctxData = &ContextData{}
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < 8; i++ {
+		stepId := fmt.Sprintf("step_%d", i)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				ctxData.SetRequestQuery(map[string]any{"j": j})
+				ctxData.SetStepStatusCode(stepId, j)
+				ctxData.SetStepDataBody(stepId, map[string]any{"rows": []any{j}})
+				ctxData.SetStepVariable(stepId, map[string]any{"j": j})
+				ctxData.SetStepOutput(stepId, map[string]any{"j": j})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				snapshot := ctxData.Snapshot()
+				for _, stepData := range snapshot.Step {
+					_ = stepData.Var["j"]
+				}
+				_ = ctxData.GetStep(stepId).Data.Body
+				_ = ctxData.GetRequest().Query["j"]
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, 199, ctxData.GetStep(fmt.Sprintf("step_%d", i)).Data.StatusCode)
+	}
+}
@@ -0,0 +1,223 @@
+package context
+
+import (
+	"reflect"
+)
+
+func (req ContextRequestData) deepCopy() ContextRequestData {
+	return ContextRequestData{
+		Method:       req.Method,
+		Path:         req.Path,
+		Host:         req.Host,
+		ClientIP:     req.ClientIP,
+		Header:       copyMap(req.Header),
+		HeaderValues: copyHeaderValues(req.HeaderValues),
+		Param:        copyMap(req.Param),
+		Query:        copyMap(req.Query),
+		Cookie:       copyMap(req.Cookie),
+		Json:         copyMap(req.Json),
+		Form:         copyMap(req.Form),
+		File:         copyFiles(req.File),
+		RawBody:      copyBytes(req.RawBody),
+	}
+}
+
+func copyFiles(files map[string][]ContextRequestFile) map[string][]ContextRequestFile {
+	if files == nil {
+		return nil
+	}
+
+	result := make(map[string][]ContextRequestFile, len(files))
+	for field, fieldFiles := range files {
+		result[field] = append([]ContextRequestFile(nil), fieldFiles...)
+	}
+	return result
+}
+
+func copyHeaderValues(header map[string][]string) map[string][]string {
+	if header == nil {
+		return nil
+	}
+
+	result := make(map[string][]string, len(header))
+	for name, values := range header {
+		result[name] = append([]string(nil), values...)
+	}
+	return result
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (stepData ContextStepData) deepCopy() ContextStepData {
+	return ContextStepData{
+		Var: copyMap(stepData.Var),
+		Data: ContextStepDataBody{
+			Body:       deepCopy(stepData.Data.Body),
+			Query:      copyMap(stepData.Data.Query),
+			StatusCode: stepData.Data.StatusCode,
+		},
+		Out:  copyMap(stepData.Out),
+		Meta: stepData.Meta,
+	}
+}
+
+func copyMap(m map[string]any) map[string]any {
+	return copyMapIn(m, nil)
+}
+
+func copyMapIn(m map[string]any, path visitPath) map[string]any {
+	if m == nil {
+		return nil
+	}
+
+	result := make(map[string]any, len(m))
+	path, ok := path.visitCopy(reflect.ValueOf(m), reflect.ValueOf(result))
+	if !ok {
+		return path.copyOf(reflect.ValueOf(m)).Interface().(map[string]any)
+	}
+
+	for key, value := range m {
+		result[key] = deepCopyIn(value, path)
+	}
+	return result
+}
+
+// DeepCopy copies maps and slices recursively, ex: a value read from a View.
+func DeepCopy(value any) any {
+	return deepCopy(value)
+}
+
+// deepCopy copies maps and slices recursively, ex: a decoded JSON body or database rows. Other values are
+// returned as is, values behind a pointer are shared. A map or a slice containing itself is copied into a copy
+// containing itself.
+func deepCopy(value any) any {
+	return deepCopyIn(value, nil)
+}
+
+func deepCopyIn(value any, path visitPath) any {
+	switch typed := value.(type) {
+	case nil, string, bool, int, int64, float64:
+		return value
+	case map[string]any:
+		return copyMapIn(typed, path)
+	case []any:
+		if typed == nil {
+			return typed
+		}
+		result := make([]any, len(typed))
+		path, ok := path.visitCopy(reflect.ValueOf(typed), reflect.ValueOf(result))
+		if !ok {
+			return path.copyOf(reflect.ValueOf(typed)).Interface()
+		}
+		for i, item := range typed {
+			result[i] = deepCopyIn(item, path)
+		}
+		return result
+	case []map[string]any:
+		if typed == nil {
+			return typed
+		}
+		result := make([]map[string]any, len(typed))
+		path, ok := path.visitCopy(reflect.ValueOf(typed), reflect.ValueOf(result))
+		if !ok {
+			return path.copyOf(reflect.ValueOf(typed)).Interface()
+		}
+		for i, item := range typed {
+			result[i] = copyMapIn(item, path)
+		}
+		return result
+	}
+
+	return deepCopyValue(reflect.ValueOf(value), path).Interface()
+}
+
+func deepCopyValue(value reflect.Value, path visitPath) reflect.Value {
+	switch value.Kind() {
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.MakeMapWithSize(value.Type(), value.Len())
+		path, ok := path.visitCopy(value, result)
+		if !ok {
+			return path.copyOf(value)
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(iter.Key(), deepCopyValue(iter.Value(), path))
+		}
+		return result
+
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		path, ok := path.visitCopy(value, result)
+		if !ok {
+			return path.copyOf(value)
+		}
+		for i := 0; i < value.Len(); i++ {
+			result.Index(i).Set(deepCopyValue(value.Index(i), path))
+		}
+		return result
+
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.New(value.Type()).Elem()
+		result.Set(deepCopyValue(value.Elem(), path))
+		return result
+	}
+
+	return value
+}
+
+// visitPath holds the maps, slices and pointers from the root to the value visited, so a value containing itself,
+// ex: a map set into itself, is visited once instead of forever.
+type visitPath []visitedValue
+
+type visitedValue struct {
+	pointer uintptr
+	length  int           // of a slice, a shorter slice of the same array is another value
+	copy    reflect.Value // copy of the value, see deepCopy
+}
+
+// visit returns the path with value, ok is false when the value is already in the path.
+func (p visitPath) visit(value reflect.Value) (visitPath, bool) {
+	return p.visitCopy(value, reflect.Value{})
+}
+
+func (p visitPath) visitCopy(value, copy reflect.Value) (visitPath, bool) {
+	visited := visitedValue{pointer: value.Pointer(), copy: copy}
+	if value.Kind() == reflect.Slice {
+		if value.Len() == 0 {
+			return p, true // empty slices can share their pointer and contain nothing
+		}
+		visited.length = value.Len()
+	}
+
+	for _, ancestor := range p {
+		if ancestor.pointer == visited.pointer && ancestor.length == visited.length {
+			return p, false
+		}
+	}
+
+	return append(p, visited), true
+}
+
+// copyOf returns the copy of a value of the path.
+func (p visitPath) copyOf(value reflect.Value) reflect.Value {
+	for _, ancestor := range p {
+		if ancestor.pointer == value.Pointer() && (value.Kind() != reflect.Slice || ancestor.length == value.Len()) {
+			return ancestor.copy
+		}
+	}
+	return reflect.Value{}
+}
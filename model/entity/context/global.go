@@ -0,0 +1,57 @@
+package context
+
+// sizeFieldGlobal prefixes the size accounting of each global variable.
+const sizeFieldGlobal = "Global."
+
+// SetGlobal sets a variable shared by every step of the execution, ex: the id of the user authenticated by an
+// early step. Templates read it with {{.Global.<Key>}}, the iterations set the variable of their root context
+// data and the branches their own variables until they are merged. Global variables are never truncated.
+func (ctxData *ContextData) SetGlobal(key string, value any) error {
+	value = deepCopy(value)
+	root := ctxData.root()
+
+	root.Lock()
+	defer root.unlockAndFlush()
+
+	return root.setGlobalLocked(key, value)
+}
+
+func (ctxData *ContextData) setGlobalLocked(key string, value any) error {
+	sizeKey := sizeKey{field: sizeFieldGlobal + key}
+	_, size, _, err := ctxData.fitValue(sizeKey, value)
+	if err != nil {
+		return err
+	}
+
+	if ctxData.Global == nil {
+		ctxData.Global = make(map[string]any)
+	}
+	ctxData.Global[key] = value
+	ctxData.recordChange(sizeKey, ctxData.sizes[sizeKey], size)
+	ctxData.recordSize(sizeKey, size)
+
+	return nil
+}
+
+// GetGlobal returns a deep copy of a global variable and whether it is set.
+func (ctxData *ContextData) GetGlobal(key string) (any, bool) {
+	root := ctxData.root()
+
+	root.RLock()
+	defer root.RUnlock()
+
+	value, ok := root.Global[key]
+	if !ok && root.parent != nil {
+		return root.parent.GetGlobal(key)
+	}
+	return deepCopy(value), ok
+}
+
+// root returns the context data owning the global variables: the execution or the branch iterations are created
+// from.
+func (ctxData *ContextData) root() *ContextData {
+	for ctxData.parent != nil && !ctxData.isBranch {
+		ctxData = ctxData.parent
+	}
+	return ctxData
+}
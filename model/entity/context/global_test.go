@@ -0,0 +1,63 @@
+package context
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextData_Global(t *testing.T) {
+	ctxData := &ContextData{}
+
+	_, ok := ctxData.GetGlobal("user_id")
+	assert.False(t, ok)
+
+	assert.NoError(t, ctxData.SetGlobal("user_id", 7))
+	assert.NoError(t, ctxData.SetGlobal("user", map[string]any{"name": "John"}))
+
+	value, ok := ctxData.GetGlobal("user_id")
+	assert.True(t, ok)
+	assert.Equal(t, 7, value)
+
+	// the value returned is a copy
+	user, _ := ctxData.GetGlobal("user")
+	user.(map[string]any)["name"] = "Jane"
+	assert.Equal(t, map[string]any{"name": "John"}, ctxData.Snapshot().Global["user"])
+
+	// iterations share the globals of the root
+	iteration := ctxData.NewIteration("foreach", 0, "a").NewIteration("inner", 0, "b")
+	assert.NoError(t, iteration.SetGlobal("last", "b"))
+	value, _ = ctxData.GetGlobal("last")
+	assert.Equal(t, "b", value)
+	assert.Equal(t, 7, iteration.Snapshot().Global["user_id"])
+
+	// globals count in the total budget
+	ctxData.SetBudget(Budget{MaxTotalSize: ctxData.Size(), Policy: BudgetPolicyTruncate})
+	assert.ErrorIs(t, ctxData.SetGlobal("token", "abc"), ErrBudgetExceeded)
+	assert.NoError(t, ctxData.SetGlobal("user_id", 8))
+}
+
+func TestContextData_Global_concurrent(t *testing.T) {
+	var (
+		ctxData = &ContextData{}
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			iteration := ctxData.NewIteration("foreach", i, i)
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, iteration.SetGlobal(fmt.Sprintf("key_%d", i), j))
+				_, _ = iteration.GetGlobal("key_0")
+				_ = iteration.Snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, ctxData.Snapshot().Global, 8)
+}
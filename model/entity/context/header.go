@@ -0,0 +1,67 @@
+package context
+
+import (
+	"net/textproto"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// requestHeader is the header data accounted as one field of the budget.
+type requestHeader struct {
+	header map[string]any
+	values map[string][]string
+}
+
+// GetHeader returns the first value of a header, the name is case-insensitive. Templates and paths read the Header
+// map with the canonical name, ex: {{.Req.Header.Authorization}}, {{.Req.Header.authorization}} has no value, or
+// with any case through the header function: {{header "authorization" .Req}}.
+func (req ContextRequestData) GetHeader(name string) string {
+	if values := req.GetHeaderValues(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// GetHeaderValues returns every value of a header, the name is case-insensitive.
+func (req ContextRequestData) GetHeaderValues(name string) []string {
+	canonicalName := textproto.CanonicalMIMEHeaderKey(name)
+
+	if values, ok := req.HeaderValues[canonicalName]; ok {
+		return values
+	}
+	if value, ok := req.Header[canonicalName]; ok {
+		return toHeaderValues(value)
+	}
+
+	// headers not set by SetRequestHeader, ex: a literal ContextRequestData, may not be canonical
+	for _, key := range sortedKeys(req.HeaderValues) {
+		if strings.EqualFold(key, name) {
+			return req.HeaderValues[key]
+		}
+	}
+	for _, key := range sortedKeys(req.Header) {
+		if strings.EqualFold(key, name) {
+			return toHeaderValues(req.Header[key])
+		}
+	}
+
+	return nil
+}
+
+func toHeaderValues(value any) []string {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case []string:
+		return typed
+	case []any:
+		values := make([]string, len(typed))
+		for i, item := range typed {
+			values[i] = cast.ToString(item)
+		}
+		return values
+	}
+
+	return []string{cast.ToString(value)}
+}
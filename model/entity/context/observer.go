@@ -0,0 +1,123 @@
+package context
+
+import (
+	"context"
+	"time"
+
+	"github.com/ideagate/core/utils/pubsub"
+)
+
+// ChangeEvent describes a change of the context data, ex: for live debugging or execution traces. The events of an
+// observer can be dropped, ex: by NewPubSubObserver when its subscribers are slow, so a trace built from them can
+// miss changes.
+type ChangeEvent struct {
+	ExecutionId string    `json:"execution_id,omitempty"` // see SetExecutionId
+	StepId      string    `json:"step_id,omitempty"`      // empty for request data and global variables
+	Field       string    `json:"field"`                  // ex: Header, Data.Body, Out or Global.<Key>
+	OldSize     int64     `json:"old_size"`               // estimated size in bytes, see ContextData.Size
+	NewSize     int64     `json:"new_size"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// IChangeObserver receives the changes of the context data. OnChange is called after the change, outside of the
+// lock of the context data, and can be called from several goroutines.
+type IChangeObserver interface {
+	OnChange(event ChangeEvent)
+}
+
+// ChangeObserverFunc is a function receiving the changes of the context data.
+type ChangeObserverFunc func(event ChangeEvent)
+
+func (f ChangeObserverFunc) OnChange(event ChangeEvent) {
+	f(event)
+}
+
+// SetObserver sets the observer of the changes, nil removes it. The iterations and the branches created
+// afterwards report their changes to the same observer.
+func (ctxData *ContextData) SetObserver(observer IChangeObserver) {
+	ctxData.Lock()
+	ctxData.observer = observer
+	ctxData.Unlock()
+}
+
+// SetExecutionId sets the id of the execution set in the change events, ex: to tell the executions apart on one
+// topic. The iterations and the branches created afterwards report the same id.
+func (ctxData *ContextData) SetExecutionId(executionId string) {
+	ctxData.Lock()
+	ctxData.executionId = executionId
+	ctxData.Unlock()
+}
+
+// NewPubSubObserver returns an observer publishing every change as a ChangeEvent on the topic of the bus. The
+// events are published in order by a goroutine stopped with the context, so a slow subscriber never blocks the
+// steps writing into the context data: a change is dropped when bufferSize events are waiting.
+func NewPubSubObserver(ctx context.Context, bus pubsub.IPubSub, topic string, bufferSize int) IChangeObserver {
+	observer := &pubSubObserver{ctx: ctx, events: make(chan ChangeEvent, bufferSize)}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-observer.events:
+				bus.Publish(ctx, topic, event)
+			}
+		}
+	}()
+
+	return observer
+}
+
+type pubSubObserver struct {
+	ctx    context.Context
+	events chan ChangeEvent
+}
+
+func (o *pubSubObserver) OnChange(event ChangeEvent) {
+	if o.ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case o.events <- event:
+	default: // the buffer is full
+	}
+}
+
+// recordChange records the field written by a branch and queues the event of a change for unlockAndFlush. It must
+// be called with the write lock.
+func (ctxData *ContextData) recordChange(key sizeKey, oldSize, newSize int64) {
+	ctxData.recordWrite(key)
+
+	if ctxData.observer == nil {
+		return
+	}
+
+	ctxData.changes = append(ctxData.changes, ChangeEvent{
+		ExecutionId: ctxData.executionId,
+		StepId:      key.stepId,
+		Field:       key.field,
+		OldSize:     oldSize,
+		NewSize:     newSize,
+		Timestamp:   time.Now(),
+	})
+}
+
+// unlockAndFlush releases the write lock and sends the queued events to the observer, ex: deferred after the lock.
+func (ctxData *ContextData) unlockAndFlush() {
+	if ctxData.observer == nil {
+		ctxData.Unlock()
+		return
+	}
+
+	var (
+		changes  = ctxData.changes
+		observer = ctxData.observer
+	)
+	ctxData.changes = nil
+	ctxData.Unlock()
+
+	for _, event := range changes {
+		observer.OnChange(event)
+	}
+}
@@ -0,0 +1,186 @@
+package context
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideagate/core/utils/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+// changeRecorder keeps the events without their timestamp.
+type changeRecorder struct {
+	sync.Mutex
+	events []ChangeEvent
+}
+
+func (r *changeRecorder) OnChange(event ChangeEvent) {
+	r.Lock()
+	defer r.Unlock()
+
+	if event.Timestamp.IsZero() {
+		panic("change event without timestamp")
+	}
+	event.Timestamp = time.Time{}
+	r.events = append(r.events, event)
+}
+
+func (r *changeRecorder) Events() []ChangeEvent {
+	r.Lock()
+	defer r.Unlock()
+
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestContextData_SetObserver(t *testing.T) {
+	var (
+		ctxData  = &ContextData{}
+		recorder = &changeRecorder{}
+	)
+
+	// changes before the observer are not reported
+	ctxData.SetRequestMethod("GET")
+	ctxData.SetObserver(recorder)
+
+	ctxData.SetRequestMethod("POST")
+	ctxData.SetRequestQuery(map[string]any{"a": "xx"})
+	ctxData.SetStepStatusCode("step_1", 200)
+	ctxData.SetStepStartTime("step_1", time.Now())
+	ctxData.SetStepOutput("step_1", map[string]any{"a": "xx"})
+	ctxData.SetStepOutput("step_1", nil)
+	ctxData.SetGlobal("user_id", 1)
+
+	assert.Equal(t, []ChangeEvent{
+		{Field: "Method", OldSize: 19, NewSize: 20},
+		{Field: "Query", OldSize: 0, NewSize: 99},
+		{StepId: "step_1", Field: "Data.StatusCode", OldSize: 0, NewSize: 8},
+		{StepId: "step_1", Field: "Meta", OldSize: 0, NewSize: 0},
+		{StepId: "step_1", Field: "Out", OldSize: 0, NewSize: 99},
+		{StepId: "step_1", Field: "Out", OldSize: 99, NewSize: 0},
+		{Field: "Global.user_id", OldSize: 0, NewSize: 8},
+	}, recorder.Events())
+
+	// a rejected change is not reported
+	ctxData.SetBudget(Budget{MaxStepSize: 10})
+	assert.Error(t, ctxData.SetStepDataBody("step_1", "a long body"))
+	assert.Empty(t, recorder.Events())
+
+	// iterations and branches report to the same observer
+	iteration := ctxData.NewIteration("foreach", 0, "a")
+	iteration.SetStepAttempts("body", 1)
+	branch := ctxData.Fork()
+	branch.SetGlobal("side", "left")
+	assert.Equal(t, []ChangeEvent{
+		{StepId: "body", Field: "Meta", OldSize: 0, NewSize: 0},
+		{Field: "Global.side", OldSize: 0, NewSize: 20},
+	}, recorder.Events())
+
+	assert.NoError(t, ctxData.Merge(MergePolicyError, branch))
+	assert.Equal(t, []ChangeEvent{{Field: "Global.side", OldSize: 0, NewSize: 20}}, recorder.Events())
+
+	// the observer can read the context data
+	ctxData.SetObserver(ChangeObserverFunc(func(event ChangeEvent) {
+		_ = ctxData.GetStep(event.StepId)
+	}))
+	ctxData.SetStepStatusCode("step_1", 201)
+
+	ctxData.SetObserver(nil)
+	ctxData.SetStepStatusCode("step_1", 202)
+	assert.Empty(t, recorder.Events())
+}
+
+func TestNewPubSubObserver(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		bus         = pubsub.New()
+		ctxData     = &ContextData{}
+	)
+	defer bus.Close()
+	defer cancel()
+
+	subscribe := bus.Subscribe(ctx, "context_change", "test", pubsub.SubscribeSetting{NumBufferChan: 3})
+	ctxData.SetObserver(NewPubSubObserver(ctx, bus, "context_change", 10))
+	ctxData.SetExecutionId("exec_1")
+
+	ctxData.SetStepDataBody("mysql", "rows")
+	ctxData.SetStepError("mysql", nil)
+	ctxData.NewIteration("foreach", 0, nil).SetStepOutput("body", nil)
+
+	event := (<-subscribe.GetData()).(ChangeEvent)
+	assert.Equal(t, "exec_1", event.ExecutionId)
+	assert.Equal(t, "mysql", event.StepId)
+	assert.Equal(t, "Data.Body", event.Field)
+	assert.Equal(t, int64(20), event.NewSize)
+	assert.WithinDuration(t, time.Now(), event.Timestamp, time.Minute)
+
+	event = (<-subscribe.GetData()).(ChangeEvent)
+	assert.Equal(t, "Meta", event.Field)
+
+	// the iterations report the id of the execution
+	event = (<-subscribe.GetData()).(ChangeEvent)
+	assert.Equal(t, "exec_1", event.ExecutionId)
+	assert.Equal(t, "body", event.StepId)
+}
+
+func TestPubSubObserver_OnChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	observer := &pubSubObserver{ctx: ctx, events: make(chan ChangeEvent, 2)}
+
+	// the events over the buffer are dropped, the first ones are kept in order
+	for i := 0; i < 5; i++ {
+		observer.OnChange(ChangeEvent{Field: "Out", NewSize: int64(i)})
+	}
+	assert.Len(t, observer.events, 2)
+	assert.Equal(t, int64(0), (<-observer.events).NewSize)
+	assert.Equal(t, int64(1), (<-observer.events).NewSize)
+
+	// and every event after the context is done
+	cancel()
+	observer.OnChange(ChangeEvent{Field: "Out"})
+	assert.Empty(t, observer.events)
+}
+
+func TestNewPubSubObserver_slowSubscriber(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		bus         = pubsub.New()
+		ctxData     = &ContextData{}
+	)
+	defer bus.Close()
+	defer cancel()
+
+	// the subscriber doesn't read, the first event blocks the publishing goroutine
+	subscribe := bus.Subscribe(ctx, "context_change", "test", pubsub.SubscribeSetting{})
+	ctxData.SetObserver(NewPubSubObserver(ctx, bus, "context_change", 2))
+
+	// the steps are not blocked, the changes over the buffer are dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			ctxData.SetStepStatusCode("mysql", i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the steps are blocked by the subscriber")
+	}
+
+	var received int
+	for {
+		select {
+		case <-subscribe.GetData():
+			received++
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	assert.GreaterOrEqual(t, received, 1)
+	assert.LessOrEqual(t, received, 3)
+}
@@ -0,0 +1,188 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// DefaultMask replaces the redacted values when Redaction.Mask is empty.
+const DefaultMask = "[REDACTED]"
+
+// Redaction configures the values masked by ContextData.Redact.
+type Redaction struct {
+	// Headers are the request header names to mask, case-insensitive. A Cookie header masks every request cookie.
+	Headers []string
+	// KeyPatterns are case-insensitive glob patterns, ex: *password*, masking the values of the matching keys at
+	// any depth of the request and step data.
+	KeyPatterns []string
+	// Variables are the sensitive variables of each step, map[StepId]VariableNames. Their values are masked
+	// in the variables of the step.
+	Variables map[string][]string
+	Mask      string
+}
+
+// DefaultRedaction returns the credentials usually found in requests and responses.
+func DefaultRedaction() Redaction {
+	return Redaction{
+		Headers:     []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		KeyPatterns: []string{"*password*", "*passwd*", "*token*", "*secret*", "*api_key*", "*apikey*"},
+	}
+}
+
+// MarkSensitive adds variables of a step to the sensitive variables.
+func (r *Redaction) MarkSensitive(stepId string, names ...string) {
+	if r.Variables == nil {
+		r.Variables = make(map[string][]string)
+	}
+	r.Variables[stepId] = append(r.Variables[stepId], names...)
+}
+
+// Redact returns a copy of the context data with the sensitive values masked, ex: before logging it, sending it
+// to a websocket debugging event or persisting the execution history. The raw body is redacted when it is
+// JSON and masked otherwise.
+func (ctxData *ContextData) Redact(redaction Redaction) *ContextData {
+	var (
+		snapshot = ctxData.Snapshot()
+		redactor = newRedactor(redaction)
+	)
+
+	req := &snapshot.Req
+	for key := range req.Header {
+		if redactor.isHeader(key) || redactor.isKey(key) {
+			req.Header[key] = redactor.mask
+		}
+	}
+	for key := range req.HeaderValues {
+		if redactor.isHeader(key) || redactor.isKey(key) {
+			req.HeaderValues[key] = []string{redactor.mask}
+		}
+	}
+	if redactor.isHeader("Cookie") {
+		for key := range req.Cookie {
+			req.Cookie[key] = redactor.mask
+		}
+	}
+	for _, field := range []map[string]any{req.Param, req.Query, req.Cookie, req.Json, req.Form} {
+		redactor.redactMap(field)
+	}
+	req.RawBody = redactor.redactRawBody(req.RawBody)
+	redactor.redactMap(snapshot.Global)
+
+	for stepId, stepData := range snapshot.Step {
+		for _, name := range redaction.Variables[stepId] {
+			if _, ok := stepData.Var[name]; ok {
+				stepData.Var[name] = redactor.mask
+			}
+		}
+		redactor.redactMap(stepData.Var)
+		redactor.redactMap(stepData.Data.Query)
+		redactor.redactMap(stepData.Out)
+		stepData.Data.Body = redactor.redactValue(stepData.Data.Body)
+
+		snapshot.Step[stepId] = stepData
+	}
+
+	for frame := snapshot.Frame; frame != nil; frame = frame.Parent {
+		frame.Item = redactor.redactValue(frame.Item)
+	}
+
+	return snapshot
+}
+
+type redactor struct {
+	headers     []string
+	keyPatterns []string // lower case
+	mask        string
+}
+
+func newRedactor(redaction Redaction) *redactor {
+	r := &redactor{
+		headers: redaction.Headers,
+		mask:    redaction.Mask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+	for _, pattern := range redaction.KeyPatterns {
+		r.keyPatterns = append(r.keyPatterns, strings.ToLower(pattern))
+	}
+	return r
+}
+
+func (r *redactor) isHeader(name string) bool {
+	for _, header := range r.headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) isKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range r.keyPatterns {
+		// an invalid pattern matches nothing
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// redactMap masks the values of the sensitive keys of a map in place.
+func (r *redactor) redactMap(m map[string]any) {
+	for key, value := range m {
+		if r.isKey(key) {
+			m[key] = r.mask
+			continue
+		}
+		m[key] = r.redactValue(value)
+	}
+}
+
+// redactValue returns the value with the sensitive keys masked. Structs and typed maps and lists are converted
+// to map[string]any and []any first, a value that can't be converted is masked.
+func (r *redactor) redactValue(value any) any {
+	switch value.(type) {
+	case nil, bool, string, int, int64, uint64, float64, json.Number, []byte:
+		return value
+	}
+
+	normalized, err := normalizeValue(value)
+	if err != nil {
+		return r.mask
+	}
+
+	switch typed := normalized.(type) {
+	case map[string]any:
+		r.redactMap(typed)
+	case []any:
+		for i, item := range typed {
+			typed[i] = r.redactValue(item)
+		}
+	}
+
+	return normalized
+}
+
+func (r *redactor) redactRawBody(rawBody []byte) []byte {
+	if len(rawBody) == 0 {
+		return rawBody
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawBody))
+	decoder.UseNumber()
+
+	var body any
+	if err := decoder.Decode(&body); err != nil || decoder.More() {
+		return []byte(r.mask)
+	}
+
+	redacted, err := json.Marshal(r.redactValue(body))
+	if err != nil {
+		return []byte(r.mask)
+	}
+	return redacted
+}
@@ -0,0 +1,75 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextData_Redact(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestHeader(map[string]any{
+		"authorization":  "Bearer abc",
+		"X-Access-Token": "abc",
+		"Content-Type":   "application/json",
+	})
+	ctxData.SetRequestCookie(map[string]any{"session": "abc"})
+	ctxData.SetRequestQuery(map[string]any{"limit": 10})
+	ctxData.SetRequestJson(map[string]any{
+		"user":  map[string]any{"name": "John", "Password": "secret"},
+		"items": []any{map[string]any{"client_secret": "abc"}},
+	})
+	ctxData.SetRequestRawBody([]byte(`{"name":"John","password":"secret"}`))
+	ctxData.SetStepVariable("login", map[string]any{"pin": "1234", "name": "John"})
+	ctxData.SetStepDataBody("login", []map[string]any{{"id": 1, "api_key": "abc"}})
+	ctxData.SetStepOutput("login", map[string]any{"user": checkpointUser{Name: "John"}, "token": "abc"})
+
+	ctxData.SetGlobal("session_token", "abc")
+
+	redaction := DefaultRedaction()
+	redaction.MarkSensitive("login", "pin")
+
+	redacted := ctxData.Redact(redaction)
+
+	assert.Equal(t, map[string]any{
+		"Authorization":  DefaultMask,
+		"X-Access-Token": DefaultMask,
+		"Content-Type":   "application/json",
+	}, redacted.Req.Header)
+	assert.Equal(t, map[string][]string{
+		"Authorization":  {DefaultMask},
+		"X-Access-Token": {DefaultMask},
+		"Content-Type":   {"application/json"},
+	}, redacted.Req.HeaderValues)
+	assert.Equal(t, map[string]any{"session": DefaultMask}, redacted.Req.Cookie)
+	assert.Equal(t, map[string]any{"limit": 10}, redacted.Req.Query)
+	assert.Equal(t, map[string]any{
+		"user":  map[string]any{"name": "John", "Password": DefaultMask},
+		"items": []any{map[string]any{"client_secret": DefaultMask}},
+	}, redacted.Req.Json)
+	assert.JSONEq(t, `{"name":"John","password":"[REDACTED]"}`, string(redacted.Req.RawBody))
+
+	login := redacted.Step["login"]
+	assert.Equal(t, map[string]any{"pin": DefaultMask, "name": "John"}, login.Var)
+	assert.Equal(t, []any{map[string]any{"id": int64(1), "api_key": DefaultMask}}, login.Data.Body)
+	assert.Equal(t, map[string]any{"user": map[string]any{"name": "John", "age": int64(0)}, "token": DefaultMask}, login.Out)
+
+	assert.Equal(t, map[string]any{"session_token": DefaultMask}, redacted.Global)
+
+	// the context data is unchanged
+	assert.Equal(t, "Bearer abc", ctxData.GetRequest().GetHeader("authorization"))
+	assert.Equal(t, "secret", ctxData.GetRequest().Json["user"].(map[string]any)["Password"])
+	assert.Equal(t, "1234", ctxData.GetStep("login").Var["pin"])
+}
+
+func TestContextData_RedactRawBody(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestRawBody([]byte("password=secret"))
+
+	redacted := ctxData.Redact(Redaction{Mask: "***"})
+	assert.Equal(t, []byte("***"), redacted.Req.RawBody)
+
+	// without a configuration nothing but the unreadable raw body is masked
+	ctxData.SetRequestHeader(map[string]any{"Authorization": "Bearer abc"})
+	assert.Equal(t, "Bearer abc", ctxData.Redact(Redaction{}).Req.Header["Authorization"])
+}
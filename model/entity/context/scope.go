@@ -0,0 +1,72 @@
+package context
+
+// IterationsOutput is the output key of a step collecting the results of its iterations, see CollectIterations.
+const IterationsOutput = "Iterations"
+
+// ContextFrame is the scope of one iteration of a step running its body once per element, ex: a foreach step
+// over the rows of a mysql step.
+type ContextFrame struct {
+	StepId string        // step iterating
+	Index  int           // index of the element
+	Item   any           // element of the iteration
+	Parent *ContextFrame `json:",omitempty"` // frame of the outer iteration
+}
+
+// NewIteration returns the context data of one iteration of a step. The steps of the iteration read the data of
+// the parent and write their own data into the iteration, the parent is never changed. The request data is the
+// one of the parent, it can't be set on the iteration, and the global variables are the ones of the execution.
+// The writes are checked against the budget of the execution with the data of the parents, see SetBudget. The
+// frame keeps a deep copy of the item.
+func (ctxData *ContextData) NewIteration(stepId string, index int, item any) *ContextData {
+	ctxData.RLock()
+	defer ctxData.RUnlock()
+
+	return &ContextData{
+		Frame:       &ContextFrame{StepId: stepId, Index: index, Item: deepCopy(item), Parent: ctxData.Frame},
+		parent:      ctxData,
+		observer:    ctxData.observer,
+		executionId: ctxData.executionId,
+	}
+}
+
+// CollectIterations sets the results of the iterations of a step, in order, as a list under the IterationsOutput
+// key of the step output. The result of an iteration maps each step of the iteration to its output.
+func (ctxData *ContextData) CollectIterations(stepId string, iterations []*ContextData) error {
+	results := make([]any, len(iterations))
+	for i, iteration := range iterations {
+		iteration.RLock()
+		result := make(map[string]any, len(iteration.Step))
+		for iterationStepId, stepData := range iteration.Step {
+			result[iterationStepId] = copyMap(stepData.Out)
+		}
+		iteration.RUnlock()
+
+		results[i] = result
+	}
+
+	ctxData.Lock()
+	defer ctxData.unlockAndFlush()
+
+	out := copyMap(ctxData.Step[stepId].Out)
+	if out == nil {
+		out = make(map[string]any, 1)
+	}
+	out[IterationsOutput] = results
+
+	return ctxData.setStepLocked(stepId, sizeFieldOut, out, func(stepData *ContextStepData, value any) {
+		stepData.Out, _ = value.(map[string]any)
+	})
+}
+
+func (frame *ContextFrame) deepCopy() *ContextFrame {
+	if frame == nil {
+		return nil
+	}
+
+	return &ContextFrame{
+		StepId: frame.StepId,
+		Index:  frame.Index,
+		Item:   deepCopy(frame.Item),
+		Parent: frame.Parent.deepCopy(),
+	}
+}
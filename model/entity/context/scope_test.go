@@ -0,0 +1,120 @@
+package context
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextData_NewIteration(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestMethod("POST")
+	ctxData.SetStepDataBody("mysql", []any{"a", "b"})
+	ctxData.SetStepOutput("transform", map[string]any{"value": "parent"})
+
+	iteration := ctxData.NewIteration("foreach", 1, "b")
+	iteration.SetStepOutput("transform", map[string]any{"value": "B"})
+
+	// the iteration reads the parent and hides the steps it writes
+	assert.Equal(t, "POST", iteration.GetRequest().Method)
+	assert.Equal(t, []any{"a", "b"}, iteration.GetStep("mysql").Data.Body)
+	assert.Equal(t, "B", iteration.GetStep("transform").Out["value"])
+
+	snapshot := iteration.Snapshot()
+	assert.Equal(t, "POST", snapshot.Req.Method)
+	assert.Equal(t, []any{"a", "b"}, snapshot.Step["mysql"].Data.Body)
+	assert.Equal(t, "B", snapshot.Step["transform"].Out["value"])
+	assert.Equal(t, &ContextFrame{StepId: "foreach", Index: 1, Item: "b"}, snapshot.Frame)
+
+	// the parent doesn't see the data of the iteration
+	assert.Equal(t, "parent", ctxData.GetStep("transform").Out["value"])
+	assert.Nil(t, ctxData.Snapshot().Frame)
+
+	// nested iterations keep the outer frame
+	nested := iteration.NewIteration("inner", 0, "x")
+	assert.Equal(t, &ContextFrame{
+		StepId: "inner",
+		Item:   "x",
+		Parent: &ContextFrame{StepId: "foreach", Index: 1, Item: "b"},
+	}, nested.Snapshot().Frame)
+	assert.Equal(t, "B", nested.GetStep("transform").Out["value"])
+}
+
+func TestContextData_NewIteration_budget(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetBudget(Budget{MaxStepSize: 100, MaxTotalSize: 240})
+	assert.NoError(t, ctxData.SetStepDataBody("mysql", strings.Repeat("x", 84)))
+
+	iteration := ctxData.NewIteration("foreach", 0, "a")
+	nested := iteration.NewIteration("inner", 0, "x")
+
+	// a value over the budget of the execution is not set by an iteration
+	var budgetErr *BudgetError
+	assert.ErrorAs(t, nested.SetStepDataBody("body", strings.Repeat("x", 1<<20)), &budgetErr)
+	assert.Equal(t, BudgetScopeExecution, budgetErr.Scope)
+	assert.Nil(t, nested.GetStep("body").Data.Body)
+
+	// the data of the parents counts in the total
+	assert.NoError(t, iteration.SetStepDataBody("body", strings.Repeat("x", 84)))
+	assert.ErrorIs(t, nested.SetStepDataBody("other", strings.Repeat("x", 84)), ErrBudgetExceeded)
+	assert.NoError(t, nested.SetStepDataBody("other", strings.Repeat("x", 16)))
+
+	// the budget set on an iteration is the one of the execution
+	iteration.SetBudget(Budget{MaxStepSize: 10, Policy: BudgetPolicyTruncate})
+	assert.NoError(t, nested.SetStepDataBody("other", strings.Repeat("x", 20)))
+	assert.True(t, nested.GetStep("other").Meta.Truncated)
+	assert.NoError(t, ctxData.SetStepDataBody("mysql", strings.Repeat("x", 20)))
+	assert.True(t, ctxData.GetStep("mysql").Meta.Truncated)
+}
+
+func TestContextData_NewIteration_request(t *testing.T) {
+	ctxData := &ContextData{}
+	ctxData.SetRequestMethod("POST")
+	iteration := ctxData.NewIteration("foreach", 0, "a")
+
+	// the request data is the one of the execution
+	assert.ErrorIs(t, iteration.SetRequestMethod("GET"), ErrNotExecution)
+	assert.ErrorIs(t, iteration.SetRequestJson(map[string]any{"id": 1}), ErrNotExecution)
+	assert.ErrorIs(t, iteration.Fork().SetRequestPath("/"), ErrNotExecution)
+	assert.Equal(t, "POST", iteration.GetRequest().Method)
+	assert.Nil(t, iteration.GetRequest().Json)
+}
+
+func TestContextData_CollectIterations(t *testing.T) {
+	var (
+		ctxData    = &ContextData{}
+		items      = []any{"a", "b", "c"}
+		iterations = make([]*ContextData, len(items))
+		wg         sync.WaitGroup
+	)
+	ctxData.SetStepOutput("foreach", map[string]any{"count": 3})
+
+	// iterations can run in parallel
+	for i, item := range items {
+		iterations[i] = ctxData.NewIteration("foreach", i, item)
+
+		wg.Add(1)
+		go func(iteration *ContextData) {
+			defer wg.Done()
+			iteration.SetStepOutput("upper", map[string]any{"value": iteration.Frame.Item.(string) + "!"})
+			_ = iteration.Snapshot()
+		}(iterations[i])
+	}
+	wg.Wait()
+
+	assert.NoError(t, ctxData.CollectIterations("foreach", iterations))
+	assert.Equal(t, map[string]any{
+		"count": 3,
+		IterationsOutput: []any{
+			map[string]any{"upper": map[string]any{"value": "a!"}},
+			map[string]any{"upper": map[string]any{"value": "b!"}},
+			map[string]any{"upper": map[string]any{"value": "c!"}},
+		},
+	}, ctxData.GetStep("foreach").Out)
+
+	// the budget applies to the collected results
+	ctxData.SetBudget(Budget{MaxStepSize: 10})
+	assert.ErrorIs(t, ctxData.CollectIterations("foreach", iterations), ErrBudgetExceeded)
+}
@@ -0,0 +1,473 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Budget limits the estimated memory of the context data, a zero limit is unlimited.
+type Budget struct {
+	MaxStepSize  int64 // bytes of the data of one step: variables, body and outputs
+	MaxTotalSize int64 // bytes of the whole context data: request and every step
+	Policy       BudgetPolicy
+}
+
+type BudgetPolicy int
+
+const (
+	// BudgetPolicyError fails the set operation with a *BudgetError, the data is not changed.
+	BudgetPolicyError BudgetPolicy = iota
+	// BudgetPolicyTruncate cuts the step data to fit and sets ContextStepMeta.Truncated. Lists and maps keep
+	// their first elements (maps by sorted key), strings and bytes their first bytes, ex: the error of the
+	// execution metadata, other values are dropped. Request data and status codes are never truncated.
+	BudgetPolicyTruncate
+)
+
+// Budget scopes, used as BudgetError.Scope.
+const (
+	BudgetScopeStep      = "step"
+	BudgetScopeExecution = "execution"
+)
+
+var ErrBudgetExceeded = errors.New("context data budget exceeded")
+
+// BudgetError is returned by a set operation exceeding the budget, it matches ErrBudgetExceeded.
+type BudgetError struct {
+	StepId string // empty for request data
+	Field  string
+	Scope  string
+	Size   int64 // estimated size with the new value
+	Limit  int64
+}
+
+func (e *BudgetError) Error() string {
+	target := "request"
+	if e.StepId != "" {
+		target = "step " + e.StepId
+	}
+	return fmt.Sprintf("%s: %s %s: %d bytes over the %s limit of %d bytes", ErrBudgetExceeded, target, e.Field, e.Size, e.Scope, e.Limit)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// Fields of the size accounting of the step data.
+const (
+	sizeFieldVar        = "Var"
+	sizeFieldBody       = "Data.Body"
+	sizeFieldOut        = "Out"
+	sizeFieldStatusCode = "Data.StatusCode"
+	sizeFieldMeta       = "Meta" // the size of the error, the other fields have a fixed size
+)
+
+type sizeKey struct {
+	stepId string // empty for request data
+	field  string
+}
+
+// SetBudget sets the memory budget checked by the next set operations, the data already set is not checked. The
+// budget is the one of the execution, the iterations and the branches check their writes against it with the
+// data of their parents: set on an iteration or a branch, it's set on the context data they are created from.
+func (ctxData *ContextData) SetBudget(budget Budget) {
+	for ctxData.parent != nil {
+		ctxData = ctxData.parent
+	}
+
+	ctxData.Lock()
+	ctxData.budget = budget
+	ctxData.Unlock()
+}
+
+// Size returns the estimated size in bytes of the whole context data.
+func (ctxData *ContextData) Size() int64 {
+	ctxData.Lock()
+	defer ctxData.Unlock()
+
+	ctxData.initSizes()
+	return ctxData.totalSize
+}
+
+// StepSize returns the estimated size in bytes of the data of a step.
+func (ctxData *ContextData) StepSize(stepId string) int64 {
+	ctxData.Lock()
+	defer ctxData.Unlock()
+
+	ctxData.initSizes()
+	return ctxData.stepSize(stepId)
+}
+
+// initSizes estimates the data already in the context, ex: after a snapshot or a restore. It must be called
+// with the write lock.
+func (ctxData *ContextData) initSizes() {
+	if ctxData.sizes != nil {
+		return
+	}
+
+	ctxData.sizes = make(map[sizeKey]int64)
+	ctxData.totalSize = 0
+
+	for field, value := range ctxData.Req.sizedFields() {
+		ctxData.recordSize(sizeKey{field: field}, estimateSize(value))
+	}
+	for key, value := range ctxData.Global {
+		ctxData.recordSize(sizeKey{field: sizeFieldGlobal + key}, estimateSize(value))
+	}
+	for stepId, stepData := range ctxData.Step {
+		for field, value := range stepData.sizedFields() {
+			ctxData.recordSize(sizeKey{stepId: stepId, field: field}, estimateSize(value))
+		}
+	}
+}
+
+func (req ContextRequestData) sizedFields() map[string]any {
+	return map[string]any{
+		"Header":   requestHeader{req.Header, req.HeaderValues},
+		"Param":    req.Param,
+		"Query":    req.Query,
+		"Cookie":   req.Cookie,
+		"Json":     req.Json,
+		"Form":     req.Form,
+		"File":     req.File,
+		"RawBody":  req.RawBody,
+		"Method":   sizedString(req.Method),
+		"Path":     sizedString(req.Path),
+		"Host":     sizedString(req.Host),
+		"ClientIP": sizedString(req.ClientIP),
+	}
+}
+
+func (stepData ContextStepData) sizedFields() map[string]any {
+	return map[string]any{
+		sizeFieldVar:        stepData.Var,
+		sizeFieldBody:       stepData.Data.Body,
+		sizeFieldOut:        stepData.Out,
+		sizeFieldStatusCode: sizedStatusCode(stepData.Data.StatusCode),
+		sizeFieldMeta:       sizedMeta(stepData.Meta),
+	}
+}
+
+// sizedString returns the value of a string field counted by the budget, nothing for an empty string.
+func sizedString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func sizedStatusCode(statusCode int) any {
+	if statusCode == 0 {
+		return nil
+	}
+	return statusCode
+}
+
+func sizedMeta(meta ContextStepMeta) any {
+	return sizedString(meta.Error)
+}
+
+func (ctxData *ContextData) recordSize(key sizeKey, size int64) {
+	ctxData.totalSize += size - ctxData.sizes[key]
+	if size == 0 {
+		delete(ctxData.sizes, key)
+		return
+	}
+	ctxData.sizes[key] = size
+}
+
+func (ctxData *ContextData) stepSize(stepId string) int64 {
+	return ctxData.sizes[sizeKey{stepId, sizeFieldVar}] + ctxData.sizes[sizeKey{stepId, sizeFieldBody}] +
+		ctxData.sizes[sizeKey{stepId, sizeFieldOut}] + ctxData.sizes[sizeKey{stepId, sizeFieldStatusCode}] +
+		ctxData.sizes[sizeKey{stepId, sizeFieldMeta}]
+}
+
+// fitValue checks the new value of a field against the budget. It returns the value to set, truncated when the
+// policy allows it, and its size. It must be called with the write lock.
+func (ctxData *ContextData) fitValue(key sizeKey, value any) (result any, size int64, truncated bool, err error) {
+	ctxData.initSizes()
+
+	size = estimateSize(value)
+
+	var (
+		budget, totalSize = ctxData.budget, ctxData.totalSize
+		oldSize           = ctxData.sizes[key]
+		available         = int64(-1) // unlimited
+		budgetErr         *BudgetError
+	)
+
+	// an iteration or a branch adds its data to the data of its parents
+	if ctxData.parent != nil {
+		var parentSize int64
+		budget, parentSize = ctxData.parent.budgetUsage()
+		totalSize += parentSize
+	}
+
+	if limit := budget.MaxTotalSize; limit > 0 {
+		available = limit - (totalSize - oldSize)
+		if newTotal := totalSize - oldSize + size; newTotal > limit {
+			budgetErr = &BudgetError{StepId: key.stepId, Field: key.field, Scope: BudgetScopeExecution, Size: newTotal, Limit: limit}
+		}
+	}
+
+	if limit := budget.MaxStepSize; limit > 0 && key.stepId != "" {
+		stepAvailable := limit - (ctxData.stepSize(key.stepId) - oldSize)
+		if available < 0 || stepAvailable < available {
+			available = stepAvailable
+		}
+		if newStepSize := ctxData.stepSize(key.stepId) - oldSize + size; newStepSize > limit && budgetErr == nil {
+			budgetErr = &BudgetError{StepId: key.stepId, Field: key.field, Scope: BudgetScopeStep, Size: newStepSize, Limit: limit}
+		}
+	}
+
+	if budgetErr == nil {
+		return value, size, false, nil
+	}
+
+	if budget.Policy != BudgetPolicyTruncate || key.stepId == "" || key.field == sizeFieldStatusCode {
+		return nil, 0, false, budgetErr
+	}
+
+	result = truncateValue(value, max(available, 0))
+	return result, estimateSize(result), true, nil
+}
+
+// budgetUsage returns the budget of the execution and the estimated size of the context data and of its parents,
+// the writes of an iteration or a branch are checked against. The context data is locked after its children.
+func (ctxData *ContextData) budgetUsage() (Budget, int64) {
+	ctxData.Lock()
+	ctxData.initSizes()
+	budget, size, parent := ctxData.budget, ctxData.totalSize, ctxData.parent
+	ctxData.Unlock()
+
+	if parent != nil {
+		var parentSize int64
+		budget, parentSize = parent.budgetUsage()
+		size += parentSize
+	}
+	return budget, size
+}
+
+// Estimated sizes of the Go values, close to the memory they use on 64-bit platforms.
+const (
+	sizeWord   = 8
+	sizeString = 16 // string header
+	sizeSlice  = 24 // slice header
+	sizeMap    = 48 // map header
+	sizeTime   = 24 // time.Time, the location is shared
+)
+
+// EstimateSize returns an estimation in bytes of the memory used by a value, the one checked by the budgets.
+func EstimateSize(value any) int64 {
+	return estimateSize(value)
+}
+
+// estimateSize returns an estimation in bytes of the memory used by a value.
+func estimateSize(value any) int64 {
+	return estimateSizeIn(value, nil)
+}
+
+// estimateSizeIn estimates a value visited from the maps and slices of path, a value containing itself counts its
+// reference once.
+func estimateSizeIn(value any, path visitPath) int64 {
+	switch typed := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int, int64, uint64, float64:
+		return sizeWord
+	case time.Time:
+		return sizeTime
+	case string:
+		return sizeString + int64(len(typed))
+	case []byte:
+		if typed == nil {
+			return 0
+		}
+		return sizeSlice + int64(len(typed))
+	case map[string]any:
+		if typed == nil {
+			return 0
+		}
+		path, ok := path.visit(reflect.ValueOf(typed))
+		if !ok {
+			return sizeWord
+		}
+		size := int64(sizeMap)
+		for key, item := range typed {
+			size += sizeString + int64(len(key)) + sizeString + estimateSizeIn(item, path)
+		}
+		return size
+	case []any:
+		if typed == nil {
+			return 0
+		}
+		path, ok := path.visit(reflect.ValueOf(typed))
+		if !ok {
+			return sizeWord
+		}
+		size := int64(sizeSlice)
+		for _, item := range typed {
+			size += sizeString + estimateSizeIn(item, path) // interface header
+		}
+		return size
+	}
+
+	return estimateValueSize(reflect.ValueOf(value), path)
+}
+
+func estimateValueSize(value reflect.Value, path visitPath) int64 {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.String:
+		return sizeString + int64(value.Len())
+	case reflect.Interface:
+		if value.IsNil() {
+			return sizeWord
+		}
+		return sizeWord + estimateValueSize(value.Elem(), path)
+	case reflect.Pointer:
+		if value.IsNil() {
+			return sizeWord
+		}
+		path, ok := path.visit(value)
+		if !ok {
+			return sizeWord
+		}
+		return sizeWord + estimateValueSize(value.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return 0
+		}
+		size := int64(0)
+		if value.Kind() == reflect.Slice {
+			var ok bool
+			if path, ok = path.visit(value); !ok {
+				return sizeWord
+			}
+			size = sizeSlice
+		}
+		for i := 0; i < value.Len(); i++ {
+			size += estimateValueSize(value.Index(i), path)
+		}
+		return size
+	case reflect.Map:
+		if value.IsNil() {
+			return 0
+		}
+		path, ok := path.visit(value)
+		if !ok {
+			return sizeWord
+		}
+		size := int64(sizeMap)
+		iter := value.MapRange()
+		for iter.Next() {
+			size += estimateValueSize(iter.Key(), path) + estimateValueSize(iter.Value(), path)
+		}
+		return size
+	case reflect.Struct:
+		if value.Type() == reflect.TypeOf(time.Time{}) {
+			return sizeTime
+		}
+		size := int64(0)
+		for i := 0; i < value.NumField(); i++ {
+			size += estimateValueSize(value.Field(i), path)
+		}
+		return size
+	}
+
+	return sizeWord
+}
+
+// truncateValue returns the largest leading part of the value fitting in maxSize bytes.
+func truncateValue(value any, maxSize int64) any {
+	if estimateSize(value) <= maxSize {
+		return value
+	}
+
+	switch typed := value.(type) {
+	case string:
+		n := int(max(maxSize-sizeString, 0))
+		for n > 0 && n < len(typed) && !utf8.RuneStart(typed[n]) {
+			n--
+		}
+		if maxSize < sizeString {
+			return nil
+		}
+		return typed[:n]
+
+	case []byte:
+		if maxSize < sizeSlice {
+			return nil
+		}
+		return typed[:maxSize-sizeSlice]
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Slice:
+		n, size := 0, estimateSize(reflectValue.Slice(0, 0).Interface())
+		if size > maxSize {
+			return nil
+		}
+		for ; n < reflectValue.Len(); n++ {
+			itemSize := estimateSize(reflectValue.Slice(n, n+1).Interface()) - sizeSlice
+			if size+itemSize > maxSize {
+				break
+			}
+			size += itemSize
+		}
+		return reflectValue.Slice(0, n).Interface()
+
+	case reflect.Map:
+		if reflectValue.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+
+		keys := make([]string, 0, reflectValue.Len())
+		for _, key := range reflectValue.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+
+		result := reflect.MakeMap(reflectValue.Type())
+		size := estimateSize(result.Interface())
+		if size > maxSize {
+			return nil
+		}
+
+		// the size of each entry is added as estimateSize counts it
+		_, isAnyMap := value.(map[string]any)
+		for _, key := range keys {
+			keyValue := reflect.ValueOf(key).Convert(reflectValue.Type().Key())
+			item := reflectValue.MapIndex(keyValue)
+
+			var itemSize int64
+			if isAnyMap {
+				itemSize = sizeString + int64(len(key)) + sizeString + estimateSize(item.Interface())
+			} else {
+				itemSize = estimateValueSize(keyValue, nil) + estimateValueSize(item, nil)
+			}
+			if size+itemSize > maxSize {
+				break
+			}
+
+			result.SetMapIndex(keyValue, item)
+			size += itemSize
+		}
+		return result.Interface()
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package context
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_estimateSize(t *testing.T) {
+	cyclicMap := map[string]any{}
+	cyclicMap["self"] = cyclicMap
+	cyclicList := []any{nil}
+	cyclicList[0] = cyclicList
+	type node struct{ Next *node }
+	cyclicNode := &node{}
+	cyclicNode.Next = cyclicNode
+
+	tests := []struct {
+		name  string
+		value any
+		want  int64
+	}{
+		{name: "nil", value: nil, want: 0},
+		{name: "int", value: 1, want: 8},
+		{name: "string", value: "abc", want: 16 + 3},
+		{name: "bytes", value: []byte("abc"), want: 24 + 3},
+		{name: "map", value: map[string]any{"a": "xx"}, want: 48 + (16 + 1) + 16 + (16 + 2)},
+		{name: "list", value: []any{1, "a"}, want: 24 + (16 + 8) + (16 + 16 + 1)},
+		{name: "typed list", value: []map[string]any{{}}, want: 24 + 48},
+		{name: "struct", value: checkpointUser{Name: "John", Age: 30}, want: (16 + 4) + 8},
+		{name: "map containing itself", value: cyclicMap, want: 48 + (16 + 4) + 16 + 8},
+		{name: "list containing itself", value: cyclicList, want: 24 + 16 + 8},
+		{name: "pointer to itself", value: cyclicNode, want: 8 + 8},
+		{name: "shared value", value: []any{[]any{}, []any{}}, want: 24 + 2*(16+24)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, estimateSize(tt.value))
+		})
+	}
+}
+
+func Test_truncateValue(t *testing.T) {
+	// map[string]any entries: 16 + 1 + 16 + (16 + 2) = 51 bytes each, over a 48 bytes map
+	anyMap := map[string]any{"c": "zz", "a": "xx", "b": "yy"}
+	// map[string]string entries: (16 + 1) + (16 + 2) = 35 bytes each
+	stringMap := map[string]string{"c": "zz", "a": "xx", "b": "yy"}
+
+	tests := []struct {
+		name    string
+		value   any
+		maxSize int64
+		want    any
+	}{
+		{name: "fits", value: anyMap, maxSize: 1000, want: anyMap},
+		{name: "map by sorted key", value: anyMap, maxSize: 48 + 2*51, want: map[string]any{"a": "xx", "b": "yy"}},
+		{name: "map below an entry", value: anyMap, maxSize: 48 + 50, want: map[string]any{}},
+		{name: "map below the header", value: anyMap, maxSize: 47, want: nil},
+		{name: "typed map", value: stringMap, maxSize: 48 + 35, want: map[string]string{"a": "xx"}},
+		{name: "list", value: []any{"xx", "yy"}, maxSize: 24 + 34, want: []any{"xx"}},
+		{name: "string", value: "héllo", maxSize: 16 + 2, want: "h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateValue(tt.value, tt.maxSize)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, estimateSize(got), tt.maxSize)
+		})
+	}
+}
+
+func TestContextData_Size(t *testing.T) {
+	ctxData := &ContextData{
+		Req: ContextRequestData{Json: map[string]any{"id": 1}},
+	}
+
+	// data set before the first set operation is counted
+	jsonSize := estimateSize(map[string]any{"id": 1})
+	assert.Equal(t, jsonSize, ctxData.Size())
+
+	assert.NoError(t, ctxData.SetStepOutput("step_1", map[string]any{"a": "xx"}))
+	assert.NoError(t, ctxData.SetStepDataBody("step_1", "body"))
+	assert.Equal(t, int64(99+20), ctxData.StepSize("step_1"))
+	assert.Equal(t, jsonSize+99+20, ctxData.Size())
+
+	// a new value replaces the size of the previous one
+	assert.NoError(t, ctxData.SetStepDataBody("step_1", nil))
+	assert.Equal(t, int64(99), ctxData.StepSize("step_1"))
+	assert.Equal(t, jsonSize+99, ctxData.Size())
+
+	// a snapshot has the same size
+	assert.Equal(t, ctxData.Size(), ctxData.Snapshot().Size())
+}
+
+func TestContextData_SetBudget(t *testing.T) {
+	t.Run("step limit", func(t *testing.T) {
+		ctxData := &ContextData{}
+		ctxData.SetBudget(Budget{MaxStepSize: 100})
+
+		assert.NoError(t, ctxData.SetStepOutput("step_1", map[string]any{"a": "xx"}))
+
+		err := ctxData.SetStepDataBody("step_1", "body")
+		assert.ErrorIs(t, err, ErrBudgetExceeded)
+
+		var budgetErr *BudgetError
+		assert.True(t, errors.As(err, &budgetErr))
+		assert.Equal(t, &BudgetError{StepId: "step_1", Field: "Data.Body", Scope: BudgetScopeStep, Size: 119, Limit: 100}, budgetErr)
+		assert.Equal(t, "context data budget exceeded: step step_1 Data.Body: 119 bytes over the step limit of 100 bytes", err.Error())
+
+		// the data is unchanged
+		assert.Nil(t, ctxData.GetStep("step_1").Data.Body)
+		assert.Equal(t, int64(99), ctxData.Size())
+
+		// other steps have their own limit
+		assert.NoError(t, ctxData.SetStepDataBody("step_2", "body"))
+	})
+
+	t.Run("total limit", func(t *testing.T) {
+		ctxData := &ContextData{}
+		ctxData.SetBudget(Budget{MaxTotalSize: 150})
+
+		assert.NoError(t, ctxData.SetRequestRawBody(make([]byte, 76))) // 100 bytes
+		assert.NoError(t, ctxData.SetStepDataBody("step_1", strings.Repeat("a", 34)))
+
+		err := ctxData.SetStepDataBody("step_2", "body")
+		var budgetErr *BudgetError
+		assert.True(t, errors.As(err, &budgetErr))
+		assert.Equal(t, BudgetScopeExecution, budgetErr.Scope)
+		assert.Equal(t, int64(170), budgetErr.Size)
+
+		// request data is never truncated
+		ctxData.SetBudget(Budget{MaxTotalSize: 150, Policy: BudgetPolicyTruncate})
+		err = ctxData.SetRequestJson(map[string]any{"id": "1"})
+		assert.ErrorIs(t, err, ErrBudgetExceeded)
+		assert.Nil(t, ctxData.GetRequest().Json)
+
+		// replacing a value with a smaller one is allowed
+		assert.NoError(t, ctxData.SetRequestRawBody(nil))
+		assert.NoError(t, ctxData.SetRequestJson(map[string]any{"id": "1"}))
+	})
+
+	t.Run("every setter", func(t *testing.T) {
+		ctxData := &ContextData{}
+		ctxData.SetBudget(Budget{MaxStepSize: 40, MaxTotalSize: 100})
+
+		// the status code and the error of the execution metadata are step data
+		assert.NoError(t, ctxData.SetStepStatusCode("step_1", 200))
+		assert.NoError(t, ctxData.SetStepError("step_1", errors.New("timeout")))
+		assert.Equal(t, int64(8+16+7), ctxData.StepSize("step_1"))
+		assert.ErrorIs(t, ctxData.SetStepError("step_1", errors.New(strings.Repeat("x", 20))), ErrBudgetExceeded)
+		assert.Equal(t, "timeout", ctxData.GetStep("step_1").Meta.Error)
+
+		// the fixed fields of the execution metadata are not counted
+		assert.NoError(t, ctxData.SetStepStartTime("step_1", time.Now()))
+		assert.NoError(t, ctxData.SetStepAttempts("step_1", 2))
+		assert.Equal(t, int64(8), ctxData.StepSize("step_1"))
+
+		// the strings of the request are request data
+		assert.NoError(t, ctxData.SetRequestMethod("GET"))
+		assert.ErrorIs(t, ctxData.SetRequestPath("/"+strings.Repeat("a", 100)), ErrBudgetExceeded)
+		assert.Empty(t, ctxData.GetRequest().Path)
+		assert.Equal(t, int64(8+16+3), ctxData.Size())
+
+		// the error is truncated like a string, the status code is not
+		ctxData.SetBudget(Budget{MaxStepSize: 40, Policy: BudgetPolicyTruncate})
+		assert.NoError(t, ctxData.SetStepError("step_1", errors.New(strings.Repeat("x", 20))))
+		assert.Equal(t, strings.Repeat("x", 16), ctxData.GetStep("step_1").Meta.Error)
+		assert.True(t, ctxData.GetStep("step_1").Meta.Truncated)
+		assert.NoError(t, ctxData.SetStepDataBody("step_2", strings.Repeat("x", 24)))
+		assert.ErrorIs(t, ctxData.SetStepStatusCode("step_2", 200), ErrBudgetExceeded)
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		ctxData := &ContextData{}
+		ctxData.SetBudget(Budget{MaxStepSize: 100, Policy: BudgetPolicyTruncate})
+
+		assert.NoError(t, ctxData.SetStepDataBody("list", []map[string]any{{}, {}, {}}))
+		assert.Equal(t, []map[string]any{{}}, ctxData.GetStep("list").Data.Body)
+		assert.True(t, ctxData.GetStep("list").Meta.Truncated)
+		assert.LessOrEqual(t, ctxData.StepSize("list"), int64(100))
+
+		assert.NoError(t, ctxData.SetStepOutput("map", map[string]any{"a": 1, "b": 2, "c": 3}))
+		assert.Equal(t, map[string]any{"a": 1}, ctxData.GetStep("map").Out)
+
+		assert.NoError(t, ctxData.SetStepDataBody("string", strings.Repeat("é", 50)))
+		assert.Equal(t, strings.Repeat("é", 42), ctxData.GetStep("string").Data.Body)
+
+		assert.NoError(t, ctxData.SetStepDataBody("bytes", make([]byte, 200)))
+		assert.Len(t, ctxData.GetStep("bytes").Data.Body, 76)
+
+		assert.NoError(t, ctxData.SetStepDataBody("struct", struct{ Data [200]byte }{}))
+		assert.Nil(t, ctxData.GetStep("struct").Data.Body)
+
+		assert.NoError(t, ctxData.SetStepDataBody("fit", "body"))
+		assert.False(t, ctxData.GetStep("fit").Meta.Truncated)
+
+		// the checkpoints keep the flag
+		data, err := ctxData.MarshalCheckpointProto()
+		assert.NoError(t, err)
+		restored, err := UnmarshalCheckpointProto(data)
+		assert.NoError(t, err)
+		assert.True(t, restored.GetStep("list").Meta.Truncated)
+
+		data, err = ctxData.MarshalCheckpointJSON()
+		assert.NoError(t, err)
+		restored, err = UnmarshalCheckpointJSON(data)
+		assert.NoError(t, err)
+		assert.True(t, restored.GetStep("list").Meta.Truncated)
+	})
+}
@@ -3,4 +3,6 @@ package pubsub
 const (
 	TopicEventRequest  = "event_request"
 	TopicEventResponse = "event_response"
+
+	TopicEventContextChange = "event_context_change" // context.ChangeEvent of the executions
 )